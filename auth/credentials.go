@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/palantir/stacktrace"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/ed25519"
+)
+
+const totpIssuer = "deviceio"
+
+// Credentials holds a freshly generated user identity in the encodings
+// expected by sdk.ClientAuth.
+type Credentials struct {
+	UserID     string
+	PublicKey  string
+	PrivateKey string
+	TOTPSecret string
+	TOTPURL    string
+}
+
+func GenerateCredentials(userid string) (*Credentials, error) {
+	pubkey, privkey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to generate ed25519 key pair")
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: userid,
+	})
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to generate totp secret")
+	}
+
+	return &Credentials{
+		UserID:     userid,
+		PublicKey:  base64.StdEncoding.EncodeToString(pubkey),
+		PrivateKey: base64.StdEncoding.EncodeToString(privkey),
+		TOTPSecret: key.Secret(),
+		TOTPURL:    key.String(),
+	}, nil
+}
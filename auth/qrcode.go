@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"bufio"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/palantir/stacktrace"
+)
+
+const qrQuietZone = 2
+
+// WriteTerminalQR renders content as a QR code using unicode half blocks so
+// that two rows of modules fit in a single line of terminal output. Light
+// modules are drawn as blocks, which suits terminals with a dark background.
+func WriteTerminalQR(w io.Writer, content string) error {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to encode qr code")
+	}
+
+	size := code.Bounds().Dx()
+
+	light := func(x, y int) bool {
+		x -= qrQuietZone
+		y -= qrQuietZone
+
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return true
+		}
+
+		return code.At(x, y) != color.Black
+	}
+
+	buf := bufio.NewWriter(w)
+
+	for y := 0; y < size+qrQuietZone*2; y += 2 {
+		for x := 0; x < size+qrQuietZone*2; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+
+			switch {
+			case top && bottom:
+				buf.WriteString("█")
+			case top:
+				buf.WriteString("▀")
+			case bottom:
+				buf.WriteString("▄")
+			default:
+				buf.WriteString(" ")
+			}
+		}
+
+		buf.WriteString("\n")
+	}
+
+	return buf.Flush()
+}
+
+func WritePNGQR(path string, content string, size int) error {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to encode qr code")
+	}
+
+	if code, err = barcode.Scale(code, size, size); err != nil {
+		return stacktrace.Propagate(err, "failed to scale qr code")
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to create qr code image file")
+	}
+	defer f.Close()
+
+	if err = png.Encode(f, code); err != nil {
+		return stacktrace.Propagate(err, "failed to write qr code image")
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/gen"
+	"github.com/deviceio/cli/hub"
+	"github.com/palantir/stacktrace"
+)
+
+func generate() error {
+	var content []byte
+	var err error
+
+	if *genInput == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(*genInput)
+	}
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to read resource graph %v", *genInput)
+	}
+
+	graph := &hub.Graph{}
+
+	if err := json.Unmarshal(content, graph); err != nil {
+		return stacktrace.PropagateWithCode(err, exitcode.Usage, "failed to parse resource graph %v. expected the json output of hub crawl", *genInput)
+	}
+
+	src, err := gen.Generate(graph, *genPackage)
+
+	if err != nil {
+		return err
+	}
+
+	if *genOutput == "" {
+		os.Stdout.Write(src)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(*genOutput, src, 0644); err != nil {
+		return stacktrace.Propagate(err, "failed to write %v", *genOutput)
+	}
+
+	return nil
+}
@@ -3,18 +3,25 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/Songmu/prompter"
 	"github.com/alecthomas/kingpin"
+	"github.com/deviceio/cli/auth"
 	"github.com/deviceio/cli/device/fs"
 	"github.com/deviceio/cli/device/sys"
+	"github.com/deviceio/cli/exitcode"
 	"github.com/deviceio/cli/hub"
+	"github.com/deviceio/cli/output"
+	"github.com/deviceio/cli/secret"
+	"github.com/deviceio/cli/user"
 	"github.com/deviceio/dsc"
 	"github.com/deviceio/hmapi"
 	sdk "github.com/deviceio/sdk/go-sdk"
@@ -27,6 +34,10 @@ type cliconfig struct {
 	HubAddr        string `json:"hub_api_addr,omitempty"`
 	HubPort        int    `json:"hub_api_port,omitempty"`
 	TLSSkipVerify  bool   `json:"hub_api_skip_cert_verify,omitempty"`
+	HubCAFile      string `json:"hub_ca_file,omitempty"`
+	HubCertSHA256  string `json:"hub_cert_sha256,omitempty"`
+	ClientCertFile string `json:"hub_client_cert_file,omitempty"`
+	ClientKeyFile  string `json:"hub_client_key_file,omitempty"`
 	UserID         string `json:"user_id,omitempty"`
 	UserTOTPSecret string `json:"user_totp_secret,omitempty"`
 	UserPrivateKey string `json:"user_private_key,omitempty"`
@@ -34,9 +45,78 @@ type cliconfig struct {
 
 var (
 	cliApp     = kingpin.New("cli", "Deviceio Command Line Interface")
-	cliProfile = cliApp.Flag("profile", "configuration profile to use. default is 'default'").Default("default").String()
+	cliProfile = cliApp.Flag("profile", "configuration profile to use. defaults to $DEVICEIO_PROFILE, then the profile chosen with 'profile use', then 'default'").PreAction(func(*kingpin.ParseContext) error {
+		cliProfileSet = true
+		return nil
+	}).Default("default").String()
+	cliProfileSet bool
 
-	configCommand = cliApp.Command("configure", "Configure deviceio-cli")
+	cliRetries      = cliApp.Flag("retries", "times a hub request failing with a connection error, 429, 502, 503 or 504 is retried. forms are only retried when safe to repeat").Default("3").Int()
+	cliRetryMaxWait = cliApp.Flag("retry-max-wait", "longest wait before a retry, including one asked for with Retry-After").Default("10s").Duration()
+
+	cliConnectTimeout = cliApp.Flag("connect-timeout", "limit on establishing a connection to the hub").Default("10s").Duration()
+	cliRequestTimeout = cliApp.Flag("request-timeout", "limit on waiting for the hub to answer each request. streamed responses are not limited. 0 waits indefinitely").Default("0s").Duration()
+	cliKeepAlive      = cliApp.Flag("keep-alive", "tcp keep-alive period of hub connections").Default("30s").Duration()
+	cliMaxIdleConns   = cliApp.Flag("max-idle-conns", "idle connections kept open per hub for reuse").Default("16").Int()
+	cliHTTP2          = cliApp.Flag("http2", "use HTTP/2 with hubs supporting it. --no-http2 stays on HTTP/1.1").Default("true").Bool()
+
+	cliDebug = cliApp.Flag("debug", "print the stack trace of an error instead of its one line summary").Bool()
+
+	cliOutput   = cliApp.Flag("output", "format of command results: table, json, ndjson or yaml. defaults to the usual format of each command").Short('o').Enum(output.Formats...)
+	cliTemplate = cliApp.Flag("template", "Go template executed for every result instead of --output, e.g. '{{.id}}'").String()
+	cliQuery    = cliApp.Flag("query", "jsonpath query selecting the values rendered from every result, e.g. '.links.*.href'").String()
+
+	configCommand        = cliApp.Command("configure", "Configure deviceio-cli")
+	configSecretBackend  = configCommand.Flag("secret-backend", "where to store the private key and totp secret: keystore, secretservice or plain").Default("keystore").Enum("keystore", "secretservice", "plain")
+	configHubAddr        = configCommand.Flag("hub-addr", "hub api address or hostname. Any of these flags makes configure non-interactive").PreAction(setConfigNonInteractive).String()
+	configHubPort        = configCommand.Flag("hub-port", "hub api port").PreAction(setConfigNonInteractive).Int()
+	configUserID         = configCommand.Flag("user-id", "user id").PreAction(setConfigNonInteractive).String()
+	configKeyFile        = configCommand.Flag("key-file", "file containing the base64 user private key").PreAction(setConfigNonInteractive).ExistingFile()
+	configTOTPFile       = configCommand.Flag("totp-secret-file", "file containing the user totp secret").PreAction(setConfigNonInteractive).ExistingFile()
+	configCAFile         = configCommand.Flag("ca-file", "PEM bundle of certificate authorities trusted for the hub").PreAction(setConfigNonInteractive).ExistingFile()
+	configCertSHA256     = configCommand.Flag("cert-sha256", "SHA-256 fingerprint of the hub certificate public key to pin").PreAction(setConfigNonInteractive).String()
+	configClientCert     = configCommand.Flag("client-cert-file", "client certificate for mutual TLS").PreAction(setConfigNonInteractive).ExistingFile()
+	configClientKey      = configCommand.Flag("client-key-file", "client key for mutual TLS").PreAction(setConfigNonInteractive).ExistingFile()
+	configNonInteractive bool
+
+	keygenCommand = cliApp.Command("keygen", "generate a user key pair and totp secret. With --profile the result is saved into that profile")
+	keygenUserID  = keygenCommand.Flag("user-id", "user id the totp secret is enrolled for. defaults to the profile's user id").String()
+	keygenQRPNG   = keygenCommand.Flag("qr-png", "write the totp enrolment qr code to this png file instead of the terminal").String()
+	keygenQRSize  = keygenCommand.Flag("qr-size", "width and height in pixels of the png qr code").Default("256").Int()
+	keygenBackend = keygenCommand.Flag("secret-backend", "where to store secrets saved into a profile: keystore, secretservice or plain").Default("keystore").Enum("keystore", "secretservice", "plain")
+
+	secretsCommand = cliApp.Command("secrets", "manage where profile secrets are stored")
+
+	secretsMigrateCommand = secretsCommand.Command("migrate", "move plaintext private keys and totp secrets from profiles into a secret backend")
+	secretsMigrateBackend = secretsMigrateCommand.Flag("secret-backend", "backend to move secrets into: keystore or secretservice").Default("keystore").Enum("keystore", "secretservice")
+	secretsMigrateAll     = secretsMigrateCommand.Flag("all", "migrate every profile instead of only the selected one").Bool()
+
+	profileCommand = cliApp.Command("profile", "manage configuration profiles")
+
+	profileListCommand = profileCommand.Command("list", "list configuration profiles")
+
+	profileShowCommand = profileCommand.Command("show", "show a profile with secrets redacted")
+	profileShowName    = profileShowCommand.Arg("name", "profile to show. defaults to the selected profile").String()
+
+	profileUseCommand = profileCommand.Command("use", "make a profile the default for future commands")
+	profileUseName    = profileUseCommand.Arg("name", "profile to use").Required().String()
+
+	profileCopyCommand = profileCommand.Command("copy", "copy a profile")
+	profileCopySource  = profileCopyCommand.Arg("source", "profile to copy").Required().String()
+	profileCopyDest    = profileCopyCommand.Arg("destination", "name of the new profile").Required().String()
+
+	profileDeleteCommand = profileCommand.Command("delete", "delete a profile")
+	profileDeleteName    = profileDeleteCommand.Arg("name", "profile to delete").Required().String()
+	profileDeleteYes     = profileDeleteCommand.Flag("yes", "do not ask for confirmation").Short('y').Bool()
+
+	settingsCommand = cliApp.Command("config", "read and write settings of the selected profile")
+
+	settingsGetCommand = settingsCommand.Command("get", "print a setting of the selected profile, including environment overrides")
+	settingsGetKey     = settingsGetCommand.Arg("key", "setting to print").Required().String()
+
+	settingsSetCommand = settingsCommand.Command("set", "change a setting of the selected profile")
+	settingsSetKey     = settingsSetCommand.Arg("key", "setting to change").Required().String()
+	settingsSetValue   = settingsSetCommand.Arg("value", "new value").Required().String()
 
 	deviceCommand = cliApp.Command("device", "invoke device functionality")
 
@@ -56,22 +136,140 @@ var (
 
 	hubCommand = cliApp.Command("hub", "invoke hub functionality")
 
-	hubProxyCommand = hubCommand.Command("proxy", "hosts a local http proxy that signs requests to the hub api")
-	hubProxyPort    = hubProxyCommand.Flag("port", "The local port to listen on for http connections").Required().Int()
+	hubProxyCommand   = hubCommand.Command("proxy", "hosts a local http proxy that signs requests to the hub api")
+	hubProxyPort      = hubProxyCommand.Flag("port", "The local port to listen on for https connections").Int()
+	hubProxyBind      = hubProxyCommand.Flag("bind", "The local address to listen on").Default("127.0.0.1").String()
+	hubProxySocket    = hubProxyCommand.Flag("unix-socket", "listen on a unix socket only accessible to the current user instead of a tcp port").String()
+	hubProxyCert      = hubProxyCommand.Flag("cert", "tls certificate to serve. defaults to a self-signed certificate stored with the profile").ExistingFile()
+	hubProxyKey       = hubProxyCommand.Flag("key", "tls key for --cert").ExistingFile()
+	hubProxyToken     = hubProxyCommand.Flag("token", "require local clients to send 'Authorization: Bearer <token>'").Envar("DEVICEIO_PROXY_TOKEN").String()
+	hubProxyGenToken  = hubProxyCommand.Flag("generate-token", "generate a random token for --token and print it").Bool()
+	hubProxyAccessLog = hubProxyCommand.Flag("access-log", "append JSON lines access logs to this file. '-' writes to stdout").String()
+	hubProxyPolicy    = hubProxyCommand.Flag("policy", "YAML or JSON file with method and path allow/deny rules").ExistingFile()
+	hubProxyRoutes    = hubProxyCommand.Flag("route", "route requests under a path prefix to the hub of another profile, as PREFIX=PROFILE. repeatable").PlaceHolder("PREFIX=PROFILE").StringMap()
+	hubProxyHosts     = hubProxyCommand.Flag("host-route", "route requests for a Host header to the hub of another profile, as HOST=PROFILE. repeatable").PlaceHolder("HOST=PROFILE").StringMap()
+	hubProxyHealth    = hubProxyCommand.Flag("health-interval", "how often to health check each hub").Default("30s").Duration()
+
+	hubDescribeCommand = hubCommand.Command("describe", "print the links, forms and content of a hub api resource")
+	hubDescribePath    = hubDescribeCommand.Arg("path", "path of the resource, e.g. /device/<id>").Required().String()
+
+	hubBrowseCommand = hubCommand.Command("browse", "interactively follow links and submit forms of hub api resources")
+	hubBrowsePath    = hubBrowseCommand.Arg("path", "path of the resource to start at").Default("/").String()
+
+	hubSubmitCommand = hubCommand.Command("submit", "submit any form of a hub api resource and stream the response to stdout")
+	hubSubmitPath    = hubSubmitCommand.Arg("resource-path", "path of the resource defining the form").Required().String()
+	hubSubmitForm    = hubSubmitCommand.Arg("form", "name of the form to submit").Required().String()
+	hubSubmitFields  = hubSubmitCommand.Flag("field", "string field as name=value. repeatable").PlaceHolder("NAME=VALUE").Strings()
+	hubSubmitInts    = hubSubmitCommand.Flag("field-int", "integer field as name=value. repeatable").PlaceHolder("NAME=VALUE").Strings()
+	hubSubmitBools   = hubSubmitCommand.Flag("field-bool", "boolean field as name=value. repeatable").PlaceHolder("NAME=VALUE").Strings()
+	hubSubmitFiles   = hubSubmitCommand.Flag("field-file", "octet-stream field uploaded from a file as name=@path. '@-' reads stdin. repeatable").PlaceHolder("NAME=@PATH").Strings()
+	hubSubmitInclude = hubSubmitCommand.Flag("include", "print the response status, headers and trailers").Short('i').Bool()
+
+	hubCurlCommand      = hubCommand.Command("curl", "send a signed request to the hub api with curl-like options")
+	hubCurlPath         = hubCurlCommand.Arg("path", "path and query of the request, e.g. /device?limit=10").Required().String()
+	hubCurlMethod       = hubCurlCommand.Flag("request", "request method. defaults to GET, or POST with --data").Short('X').String()
+	hubCurlHeaders      = hubCurlCommand.Flag("header", "request header as 'Name: value'. repeatable").Short('H').Strings()
+	hubCurlData         = hubCurlCommand.Flag("data", "request body. '@file' reads a file and '@-' reads stdin").Short('d').String()
+	hubCurlInclude      = hubCurlCommand.Flag("include", "print the response status, headers and trailers").Short('i').Bool()
+	hubCurlPrintHeaders = hubCurlCommand.Flag("print-headers", "print the signed request headers to stderr").Bool()
+	hubCurlEmit         = hubCurlCommand.Flag("emit-curl", "print a curl command with the signed Authorization header instead of sending the request. it is valid for the current totp window").Bool()
+
+	hubCrawlCommand = hubCommand.Command("crawl", "follow hub api links and export the resource graph")
+	hubCrawlRoot    = hubCrawlCommand.Flag("root", "path of the resource to start at").Default("/").String()
+	hubCrawlDepth   = hubCrawlCommand.Flag("depth", "how many links away from the root to follow").Default("5").Int()
+	hubCrawlDevice  = hubCrawlCommand.Flag("device", "crawl the resources of this device instead of --root").String()
+	hubCrawlFormat  = hubCrawlCommand.Flag("format", "graph format: json, dot or markdown. json is rendered according to --output").Default("json").Enum("json", "dot", "markdown")
+
+	hubContentCommand = hubCommand.Command("content", "print a content value of a hub api resource")
+	hubContentPath    = hubContentCommand.Arg("path", "path of the resource").Required().String()
+	hubContentName    = hubContentCommand.Arg("name", "name of the content value").Required().String()
+
+	hubGetCommand = hubCommand.Command("get", "print a hub api resource as JSON or follow one of its links")
+	hubGetPath    = hubGetCommand.Arg("path", "path of the resource").Required().String()
+	hubGetLink    = hubGetCommand.Flag("link", "follow this link of the resource and stream its response to stdout").String()
+	hubGetInclude = hubGetCommand.Flag("include", "print the response status, headers and trailers of a followed link").Short('i').Bool()
+
+	genCommand = cliApp.Command("gen", "generate typed Go wrappers for hub api resources from the json output of hub crawl")
+	genInput   = genCommand.Flag("input", "resource graph written by 'hub crawl --format json'. '-' reads stdin").Default("-").String()
+	genPackage = genCommand.Flag("package", "package name of the generated source").Default("client").String()
+	genOutput  = genCommand.Flag("output-file", "write the generated source to this file instead of stdout").String()
+
+	userCommand = cliApp.Command("user", "manage hub users")
+
+	userListCommand = userCommand.Command("list", "list users registered with the hub")
+
+	userCreateCommand = userCommand.Command("create", "create a hub user with a locally generated key pair and totp secret")
+	userCreateID      = userCreateCommand.Arg("user-id", "id of the user to create").Required().String()
+	userCreateOutput  = userCreateCommand.Flag("output-file", "write the new user's profile to this file instead of stdout").String()
+
+	userUpdateCommand = userCommand.Command("update", "rotate the key pair and totp secret of a hub user")
+	userUpdateID      = userUpdateCommand.Arg("user-id", "id of the user to update").Required().String()
+	userUpdateOutput  = userUpdateCommand.Flag("output-file", "write the user's new profile to this file instead of stdout").String()
+
+	userDeleteCommand = userCommand.Command("delete", "delete a hub user")
+	userDeleteID      = userDeleteCommand.Arg("user-id", "id of the user to delete").Required().String()
 )
 
 func main() {
+	if err := run(); err != nil {
+		exit(err)
+	}
+}
+
+// exit prints err and ends the cli with the exit code of its kind. Errors are
+// printed on one line unless --debug asks for their stack traces.
+func exit(err error) {
+	if *cliDebug {
+		fmt.Fprintf(os.Stderr, "%v: error: %+s\n", filepath.Base(os.Args[0]), err)
+	} else {
+		fmt.Fprintf(os.Stderr, "%v: error: %#s\n", filepath.Base(os.Args[0]), err)
+	}
+
+	os.Exit(exitcode.Of(err))
+}
+
+func run() error {
 	homedir, err := homedir.Dir()
 
 	if err != nil {
-		log.Fatal(stacktrace.Propagate(err, "unable to locate user home directory"))
+		return stacktrace.Propagate(err, "unable to locate user home directory")
+	}
+
+	cliParse, err := cliApp.Parse(os.Args[1:])
+
+	if err != nil {
+		code := exitcode.Usage
+
+		// Any code but 255 may be the exit code of a remote process.
+		if context, _ := cliApp.ParseContext(os.Args[1:]); context != nil && context.SelectedCommand == deviceExecCommand {
+			code = exitcode.ExecFailed
+		}
+
+		return stacktrace.NewMessageWithCode(code, "%v, try --help", err)
+	}
+
+	if !*cliDebug {
+		stacktrace.DefaultFormat = stacktrace.FormatBrief
 	}
 
-	cliParse := kingpin.MustParse(cliApp.Parse(os.Args[1:]))
 	homePath := strings.Replace(fmt.Sprintf("%v/.deviceio/cli/", homedir), "\\", "/", -1)
+
+	if !cliProfileSet {
+		*cliProfile = defaultProfile(homePath)
+	}
+
+	if err := validateProfileName(*cliProfile); err != nil {
+		return err
+	}
+
 	configPath := fmt.Sprintf("%v/%v.json", homePath, *cliProfile)
 
-	ensureProfileConfigExists(configPath)
+	if err := ensureProfileConfigExists(homePath, configPath); err != nil {
+		return err
+	}
+
+	keystorePath := homePath + keystoreName + ".json"
+	secret.Register("keystore", secret.NewKeystore(keystorePath, keystorePassphrase(keystorePath)))
 
 	viper.SetConfigName(*cliProfile)
 	viper.AddConfigPath(homePath)
@@ -80,132 +278,687 @@ func main() {
 	viper.SetDefault("hub_api_addr", "127.0.0.1")
 	viper.SetDefault("hub_api_port", 4431)
 	viper.SetDefault("hub_api_skip_cert_verify", false)
+	viper.SetDefault("hub_ca_file", "")
+	viper.SetDefault("hub_cert_sha256", "")
+	viper.SetDefault("hub_client_cert_file", "")
+	viper.SetDefault("hub_client_key_file", "")
 	viper.SetDefault("user_id", "")
 	viper.SetDefault("user_totp_secret", "")
 	viper.SetDefault("user_private_key", "")
 
+	for key, env := range profileEnv {
+		viper.BindEnv(key, env)
+	}
+
 	switch cliParse {
 	case configCommand.FullCommand():
-		loadConfig()
-		configure()
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		return configure(homePath)
+
+	case keygenCommand.FullCommand():
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		return keygen(homePath)
+
+	case profileListCommand.FullCommand():
+		out, err := renderer(output.Table)
+
+		if err != nil {
+			return err
+		}
+
+		return listProfiles(homePath, out)
+
+	case profileShowCommand.FullCommand():
+		out, err := renderer(output.JSON)
+
+		if err != nil {
+			return err
+		}
+
+		return showProfile(homePath, *profileShowName, out)
+
+	case profileUseCommand.FullCommand():
+		return useProfile(homePath, *profileUseName)
+
+	case profileCopyCommand.FullCommand():
+		return copyProfile(homePath, *profileCopySource, *profileCopyDest)
+
+	case profileDeleteCommand.FullCommand():
+		return deleteProfile(homePath, *profileDeleteName, *profileDeleteYes)
+
+	case settingsGetCommand.FullCommand():
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		if err := validateProfileKey(*settingsGetKey); err != nil {
+			return err
+		}
+
+		out, err := renderer(output.Table)
+
+		if err != nil {
+			return err
+		}
+
+		return out.Render(viper.Get(*settingsGetKey))
+
+	case settingsSetCommand.FullCommand():
+		if err := validateProfileKey(*settingsSetKey); err != nil {
+			return err
+		}
+
+		return setProfileValue(configPath, *settingsSetKey, *settingsSetValue)
+
+	case secretsMigrateCommand.FullCommand():
+		return migrateSecrets(homePath, *secretsMigrateBackend, *secretsMigrateAll)
 
 	case deviceFSReadCommand.FullCommand():
-		loadConfig()
-		fs.Read(*deviceFSReadDevice, *deviceFSReadPath, createClient())
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		return fs.Read(*deviceFSReadDevice, *deviceFSReadPath, c)
 
 	case deviceFSWriteCommand.FullCommand():
-		loadConfig()
-		fs.Write(*deviceFSWriteDevice, *deviceFSWritePath, *deviceFSWriteAppend, createClient())
+		c, err := loadSDKClient()
+
+		if err != nil {
+			return err
+		}
+
+		return fs.Write(*deviceFSWriteDevice, *deviceFSWritePath, *deviceFSWriteAppend, c)
 
 	case deviceExecCommand.FullCommand():
-		loadConfig()
-		sys.Exec(*deviceExecDevice, *deviceExecCmd, *deviceExecArgs, createSDKClient())
+		c, err := loadSDKClient()
+
+		if err != nil {
+			return stacktrace.PropagateWithCode(err, exitcode.ExecFailed, "")
+		}
+
+		code, err := sys.Exec(*deviceExecDevice, *deviceExecCmd, *deviceExecArgs, c)
+
+		if err != nil {
+			return stacktrace.PropagateWithCode(err, exitcode.ExecFailed, "")
+		}
+
+		// exec exits with the exit code of the remote process.
+		if code != 0 {
+			os.Exit(code)
+		}
 
 	case hubProxyCommand.FullCommand():
-		loadConfig()
-		hub.Proxy(viper.GetString("hub_api_addr"), viper.GetInt("hub_api_port"), *hubProxyPort, &sdk.ClientAuth{
-			UserID:         viper.GetString("user_id"),
-			UserTOTPSecret: viper.GetString("user_totp_secret"),
-			UserPrivateKey: viper.GetString("user_private_key"),
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		return proxy(homePath)
+
+	case hubDescribeCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		out, err := renderer(output.Table)
+
+		if err != nil {
+			return err
+		}
+
+		return hub.Describe(c, *hubDescribePath, out)
+
+	case hubBrowseCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		hub.Browse(c, *hubBrowsePath)
+
+	case hubSubmitCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		fields, err := submitFields()
+
+		if err != nil {
+			return err
+		}
+
+		return hub.Submit(c, *hubSubmitPath, *hubSubmitForm, fields, *hubSubmitInclude)
+
+	case hubCurlCommand.FullCommand():
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		clientAuth, err := userAuth()
+
+		if err != nil {
+			return err
+		}
+
+		transport, err := hubTransport()
+
+		if err != nil {
+			return err
+		}
+
+		return hub.Curl(&hub.CurlRequest{
+			HubHost:      viper.GetString("hub_api_addr"),
+			HubPort:      viper.GetInt("hub_api_port"),
+			TLS:          profileTLSConfig(loadedProfile()),
+			Auth:         clientAuth,
+			Transport:    transport,
+			Method:       *hubCurlMethod,
+			Path:         *hubCurlPath,
+			Headers:      *hubCurlHeaders,
+			Data:         *hubCurlData,
+			Include:      *hubCurlInclude,
+			PrintHeaders: *hubCurlPrintHeaders,
+			EmitCurl:     *hubCurlEmit,
 		})
+
+	case hubCrawlCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		root := *hubCrawlRoot
+
+		if *hubCrawlDevice != "" {
+			root = fmt.Sprintf("/device/%v", *hubCrawlDevice)
+		}
+
+		out, err := renderer(output.JSON)
+
+		if err != nil {
+			return err
+		}
+
+		return hub.Crawl(c, root, *hubCrawlDepth, *hubCrawlFormat, out)
+
+	case hubContentCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		out, err := renderer(output.Table)
+
+		if err != nil {
+			return err
+		}
+
+		return hub.Content(c, *hubContentPath, *hubContentName, out)
+
+	case hubGetCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		out, err := renderer(output.JSON)
+
+		if err != nil {
+			return err
+		}
+
+		return hub.Get(c, *hubGetPath, *hubGetLink, *hubGetInclude, out)
+
+	case genCommand.FullCommand():
+		return generate()
+
+	case userListCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		out, err := renderer(output.Table)
+
+		if err != nil {
+			return err
+		}
+
+		return user.List(c, out)
+
+	case userCreateCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		creds, err := user.Create(*userCreateID, c)
+
+		if err != nil {
+			return err
+		}
+
+		return writeUserProfile(homePath, creds, *userCreateOutput)
+
+	case userUpdateCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		creds, err := user.Update(*userUpdateID, c)
+
+		if err != nil {
+			return err
+		}
+
+		return writeUserProfile(homePath, creds, *userUpdateOutput)
+
+	case userDeleteCommand.FullCommand():
+		c, err := loadClient()
+
+		if err != nil {
+			return err
+		}
+
+		return user.Delete(*userDeleteID, c)
 	}
+
+	return nil
 }
 
-func ensureProfileConfigExists(configPath string) {
+func ensureProfileConfigExists(homePath, configPath string) error {
+	if err := os.MkdirAll(homePath, 0700); err != nil {
+		return stacktrace.Propagate(err, "failed to create profile configuration directory")
+	}
+
+	if err := os.Chmod(homePath, 0700); err != nil {
+		return stacktrace.Propagate(err, "failed to restrict profile configuration directory")
+	}
+
 	f := &dsc.File{
 		Path:   configPath,
 		Absent: false,
+		Mode:   0600,
 	}
 
 	if _, err := f.Apply(); err != nil {
-		log.Fatal(stacktrace.Propagate(
+		return stacktrace.Propagate(
 			err,
 			"failed to create profile configuration file",
-		))
+		)
 	}
 
 	if content, err := ioutil.ReadFile(configPath); err != nil {
-		log.Fatal(stacktrace.Propagate(
+		return stacktrace.Propagate(
 			err,
 			"failed to write default profile configuration file json",
-		))
+		)
 	} else {
 		if string(content) == "" {
-			ioutil.WriteFile(configPath, []byte("{}"), 0666)
+			ioutil.WriteFile(configPath, []byte("{}"), 0600)
 		}
 	}
+
+	return nil
 }
 
-func loadConfig() {
+// renderer returns the renderer of command results selected by --output,
+// --template and --query. Commands pass the format they print in when
+// --output is not given.
+func renderer(defaultFormat output.Format) (*output.Renderer, error) {
+	format := output.Format(*cliOutput)
+
+	if format == "" {
+		format = defaultFormat
+	}
+
+	return output.New(os.Stdout, &output.Options{
+		Format:   format,
+		Template: *cliTemplate,
+		Query:    *cliQuery,
+		Color:    output.Color(os.Stdout),
+	})
+}
+
+func loadConfig() error {
 	if err := viper.ReadInConfig(); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Panic("Error loading profile configuration. Please run configure.")
+		return stacktrace.Propagate(err, "Error loading profile configuration. Please run configure.")
+	}
+
+	return nil
+}
+
+// loadClient loads the profile configuration and returns its hmapi client.
+func loadClient() (hmapi.Client, error) {
+	if err := loadConfig(); err != nil {
+		return nil, err
 	}
+
+	return createClient()
 }
 
-func createClient() hmapi.Client {
-	return hmapi.NewClient(&hmapi.ClientConfig{
-		Auth: &sdk.ClientAuth{
-			UserID:         viper.GetString("user_id"),
-			UserTOTPSecret: viper.GetString("user_totp_secret"),
-			UserPrivateKey: viper.GetString("user_private_key"),
-		},
+// loadSDKClient loads the profile configuration and returns its sdk client.
+func loadSDKClient() (sdk.Client, error) {
+	if err := loadConfig(); err != nil {
+		return nil, err
+	}
+
+	return createSDKClient()
+}
+
+var hubClient hmapi.Client
+
+// createClient returns the hmapi client of the loaded profile. One client is
+// shared by all commands so its descriptor cache and connections are reused.
+func createClient() (hmapi.Client, error) {
+	if hubClient != nil {
+		return hubClient, nil
+	}
+
+	clientAuth, err := userAuth()
+
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := hubTransport()
+
+	if err != nil {
+		return nil, err
+	}
+
+	hubClient = hmapi.NewClient(&hmapi.ClientConfig{
+		Auth:   clientAuth,
 		Scheme: hmapi.HTTPS,
 		Host:   viper.GetString("hub_api_addr"),
 		Port:   viper.GetInt("hub_api_port"),
-	})
-}
 
-func createSDKClient() sdk.Client {
-	return sdk.NewClient(sdk.ClientConfig{
-		UserID:     viper.GetString("user_id"),
-		TOTPSecret: viper.GetString("user_totp_secret"),
-		PrivateKey: viper.GetString("user_private_key"),
-		HubHost:    viper.GetString("hub_api_addr"),
-		HubPort:    viper.GetInt("hub_api_port"),
+		// Resource descriptors are reused for the lifetime of a command, so
+		// exec fetches the process resource once rather than per stream.
+		DescriptorTTL: 5 * time.Minute,
+
+		Retry: &hmapi.RetryPolicy{
+			MaxRetries: *cliRetries,
+			MaxWait:    *cliRetryMaxWait,
+		},
+
+		HTTPClient: &http.Client{
+			Transport: transport,
+		},
 	})
+
+	return hubClient, nil
 }
 
-func configure() {
-	homedir, err := homedir.Dir()
+func createSDKClient() (sdk.Client, error) {
+	c, err := createClient()
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	answers := &cliconfig{
-		HubAddr: prompter.Prompt("Hub API Address or Hostname", viper.GetString("hub_api_addr")),
-		HubPort: func() int {
-			port := prompter.Prompt("Hub API Port", viper.GetString("hub_api_port"))
+	return sdk.NewClient(sdk.ClientConfig{
+		HMClient: c,
+	}), nil
+}
+
+// loadedProfile returns the hub and user settings of the loaded profile.
+func loadedProfile() *cliconfig {
+	return &cliconfig{
+		HubAddr:        viper.GetString("hub_api_addr"),
+		HubPort:        viper.GetInt("hub_api_port"),
+		TLSSkipVerify:  viper.GetBool("hub_api_skip_cert_verify"),
+		HubCAFile:      viper.GetString("hub_ca_file"),
+		HubCertSHA256:  viper.GetString("hub_cert_sha256"),
+		ClientCertFile: viper.GetString("hub_client_cert_file"),
+		ClientKeyFile:  viper.GetString("hub_client_key_file"),
+		UserID:         viper.GetString("user_id"),
+		UserTOTPSecret: viper.GetString("user_totp_secret"),
+		UserPrivateKey: viper.GetString("user_private_key"),
+	}
+}
+
+func configure(homePath string) error {
+	if configNonInteractive {
+		return configureFromFlags(homePath)
+	}
 
-			i, err := strconv.Atoi(port)
+	hubAddr := prompter.Prompt("Hub API Address or Hostname", viper.GetString("hub_api_addr"))
+	hubPort, err := strconv.Atoi(prompter.Prompt("Hub API Port", viper.GetString("hub_api_port")))
 
-			if err != nil {
-				log.Fatal(err)
-			}
+	if err != nil {
+		return stacktrace.PropagateWithCode(err, exitcode.Usage, "hub api port must be a number")
+	}
 
-			return i
-		}(),
+	answers := &cliconfig{
+		HubAddr:        hubAddr,
+		HubPort:        hubPort,
+		TLSSkipVerify:  viper.GetBool("hub_api_skip_cert_verify"),
+		HubCAFile:      prompter.Prompt("Hub CA Bundle File (optional)", viper.GetString("hub_ca_file")),
+		HubCertSHA256:  viper.GetString("hub_cert_sha256"),
+		ClientCertFile: prompter.Prompt("Client Certificate File for mutual TLS (optional)", viper.GetString("hub_client_cert_file")),
+		ClientKeyFile:  prompter.Prompt("Client Key File for mutual TLS (optional)", viper.GetString("hub_client_key_file")),
 		UserID:         prompter.Prompt("User ID", viper.GetString("user_id")),
 		UserPrivateKey: prompter.Password("User Private Key"),
 		UserTOTPSecret: prompter.Password("User TOTP Secret"),
 	}
 
-	jsonb, err := json.MarshalIndent(answers, "", "    ")
+	if err := trustHubCertificate(answers); err != nil {
+		return err
+	}
+
+	if err := storeProfileSecrets(answers, *configSecretBackend); err != nil {
+		return err
+	}
+
+	return writeProfile(answers)
+}
+
+func writeProfile(profile *cliconfig) error {
+	homedir, err := homedir.Dir()
+
+	if err != nil {
+		return stacktrace.Propagate(err, "unable to locate user home directory")
+	}
+
+	jsonb, err := json.MarshalIndent(profile, "", "    ")
 
 	if err != nil {
-		panic(err)
+		return stacktrace.Propagate(err, "failed to encode profile %v", *cliProfile)
 	}
 
 	cfgdir := fmt.Sprintf("%v/.deviceio/cli", homedir)
 	cfgfile := fmt.Sprintf("%v/%v.json", cfgdir, *cliProfile)
 
-	if err := os.MkdirAll(cfgdir, 0666); err != nil {
-		panic(err)
+	if err := os.MkdirAll(cfgdir, 0700); err != nil {
+		return stacktrace.Propagate(err, "failed to create profile configuration directory")
 	}
 
-	if err := ioutil.WriteFile(cfgfile, jsonb, 0666); err != nil {
-		panic(err)
+	if err := ioutil.WriteFile(cfgfile, jsonb, 0600); err != nil {
+		return stacktrace.Propagate(err, "failed to write profile %v", cfgfile)
 	}
+
+	return nil
+}
+
+func keygen(homePath string) error {
+	userid := *keygenUserID
+
+	if userid == "" {
+		userid = viper.GetString("user_id")
+	}
+
+	if userid == "" {
+		return stacktrace.NewErrorWithCode(exitcode.Usage, "a user id is required. Pass --user-id or configure one in the profile")
+	}
+
+	creds, err := auth.GenerateCredentials(userid)
+
+	if err != nil {
+		return err
+	}
+
+	out, err := renderer(output.Table)
+
+	if err != nil {
+		return err
+	}
+
+	result := &credentials{
+		UserID:     creds.UserID,
+		PrivateKey: creds.PrivateKey,
+		TOTPSecret: creds.TOTPSecret,
+		PublicKey:  creds.PublicKey,
+		TOTPURI:    creds.TOTPURL,
+	}
+
+	if cliProfileSet {
+		// Only the generated credentials change; environment overrides of
+		// the other settings stay out of the profile file.
+		profile, err := loadProfile(homePath, *cliProfile)
+
+		if err != nil {
+			return err
+		}
+
+		profile.UserID = creds.UserID
+		profile.UserTOTPSecret = creds.TOTPSecret
+		profile.UserPrivateKey = creds.PrivateKey
+
+		if err := storeProfileSecrets(profile, *keygenBackend); err != nil {
+			return err
+		}
+
+		if err := writeProfile(profile); err != nil {
+			return err
+		}
+
+		result.PrivateKey = ""
+		result.TOTPSecret = ""
+		result.Profile = *cliProfile
+	}
+
+	if *keygenQRPNG != "" {
+		if err := auth.WritePNGQR(*keygenQRPNG, creds.TOTPURL, *keygenQRSize); err != nil {
+			return err
+		}
+	}
+
+	return out.Text(writeKeygenText).Render(result)
+}
+
+// credentials are the result of keygen and user create/update. Secrets that
+// were saved are left out, and Profile names the profile they were saved to.
+type credentials struct {
+	UserID     string `json:"user_id"`
+	PrivateKey string `json:"user_private_key,omitempty"`
+	TOTPSecret string `json:"user_totp_secret,omitempty"`
+	PublicKey  string `json:"public_key"`
+	TOTPURI    string `json:"totp_uri,omitempty"`
+	Profile    string `json:"profile,omitempty"`
+}
+
+// writeKeygenText is the table layout of keygen, which ends with the totp
+// enrolment as a qr code unless it was written to --qr-png.
+func writeKeygenText(w io.Writer, value interface{}) error {
+	creds := value.(*credentials)
+
+	if creds.Profile != "" {
+		fmt.Fprintf(w, "Saved private key and totp secret to profile '%v'\n", creds.Profile)
+	} else {
+		fmt.Fprintf(w, "User ID:      %v\n", creds.UserID)
+		fmt.Fprintf(w, "Private Key:  %v\n", creds.PrivateKey)
+		fmt.Fprintf(w, "TOTP Secret:  %v\n", creds.TOTPSecret)
+	}
+
+	fmt.Fprintf(w, "Public Key:   %v\n", creds.PublicKey)
+	fmt.Fprintf(w, "TOTP URI:     %v\n", creds.TOTPURI)
+
+	if *keygenQRPNG != "" {
+		_, err := fmt.Fprintf(w, "Wrote totp enrolment qr code to %v\n", *keygenQRPNG)
+		return err
+	}
+
+	fmt.Fprintln(w, "Scan the following qr code with your authenticator app:")
+
+	return auth.WriteTerminalQR(w, creds.TOTPURI)
+}
+
+func writeUserProfile(homePath string, creds *auth.Credentials, path string) error {
+	// The client certificate belongs to this machine rather than the new
+	// user, so only the hub trust settings of the profile file are carried
+	// over.
+	profile, err := loadProfile(homePath, *cliProfile)
+
+	if err != nil {
+		return err
+	}
+
+	profile.ClientCertFile = ""
+	profile.ClientKeyFile = ""
+	profile.UserID = creds.UserID
+	profile.UserTOTPSecret = creds.TOTPSecret
+	profile.UserPrivateKey = creds.PrivateKey
+
+	jsonb, err := json.MarshalIndent(profile, "", "    ")
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to encode user profile")
+	}
+
+	out, err := renderer(output.Table)
+
+	if err != nil {
+		return err
+	}
+
+	result := &credentials{
+		UserID:     creds.UserID,
+		PrivateKey: creds.PrivateKey,
+		TOTPSecret: creds.TOTPSecret,
+		PublicKey:  creds.PublicKey,
+		TOTPURI:    creds.TOTPURL,
+	}
+
+	if path != "" {
+		if err := ioutil.WriteFile(path, jsonb, 0600); err != nil {
+			return stacktrace.Propagate(err, "failed to write user profile")
+		}
+
+		result = &credentials{
+			UserID:    creds.UserID,
+			PublicKey: creds.PublicKey,
+			Profile:   path,
+		}
+	}
+
+	// The table layout prints the profile itself, ready to be saved as the
+	// user's profile file, and nothing once it was written to path.
+	return out.Text(func(w io.Writer, value interface{}) error {
+		if value.(*credentials).Profile != "" {
+			return nil
+		}
+
+		_, err := fmt.Fprintf(w, "%s\n", jsonb)
+		return err
+	}).Render(result)
 }
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Songmu/prompter"
+	"github.com/alecthomas/kingpin"
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/output"
+	"github.com/deviceio/cli/secret"
+	"github.com/deviceio/cli/tlsconfig"
+	"github.com/palantir/stacktrace"
+)
+
+// profileKeys lists every setting a profile may hold.
+var profileKeys = []string{
+	"hub_api_addr",
+	"hub_api_port",
+	"hub_api_skip_cert_verify",
+	"hub_ca_file",
+	"hub_cert_sha256",
+	"hub_client_cert_file",
+	"hub_client_key_file",
+	"user_id",
+	"user_totp_secret",
+	"user_private_key",
+}
+
+// profileEnv maps profile settings to the environment variables that
+// override them.
+var profileEnv = map[string]string{
+	"hub_api_addr":             "DEVICEIO_HUB_ADDR",
+	"hub_api_port":             "DEVICEIO_HUB_PORT",
+	"hub_api_skip_cert_verify": "DEVICEIO_HUB_SKIP_CERT_VERIFY",
+	"hub_ca_file":              "DEVICEIO_HUB_CA_FILE",
+	"hub_cert_sha256":          "DEVICEIO_HUB_CERT_SHA256",
+	"hub_client_cert_file":     "DEVICEIO_HUB_CLIENT_CERT_FILE",
+	"hub_client_key_file":      "DEVICEIO_HUB_CLIENT_KEY_FILE",
+	"user_id":                  "DEVICEIO_USER_ID",
+	"user_totp_secret":         "DEVICEIO_USER_TOTP_SECRET",
+	"user_private_key":         "DEVICEIO_USER_PRIVATE_KEY",
+}
+
+const defaultProfileFile = "default_profile"
+
+// keystoreName is the name of the keystore file in the profile directory,
+// which no profile may take.
+const keystoreName = "keystore"
+
+func setConfigNonInteractive(*kingpin.ParseContext) error {
+	configNonInteractive = true
+	return nil
+}
+
+// defaultProfile picks the profile used when --profile is not given:
+// $DEVICEIO_PROFILE, then the profile chosen with 'profile use'.
+func defaultProfile(homePath string) string {
+	if profile := os.Getenv("DEVICEIO_PROFILE"); profile != "" {
+		return profile
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(homePath, defaultProfileFile))
+
+	if err == nil && strings.TrimSpace(string(content)) != "" {
+		return strings.TrimSpace(string(content))
+	}
+
+	return "default"
+}
+
+func profilePath(homePath, name string) string {
+	return filepath.Join(homePath, name+".json")
+}
+
+func profileNames(homePath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(homePath, "*.json"))
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to list profiles")
+	}
+
+	names := []string{}
+
+	for _, match := range matches {
+		name := strings.TrimSuffix(filepath.Base(match), ".json")
+
+		if name == keystoreName {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// validateProfileName rejects names that would place the profile file
+// outside the profile directory or over the keystore.
+func validateProfileName(name string) error {
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return stacktrace.NewErrorWithCode(exitcode.Usage, "invalid profile name '%v'. Profile names cannot contain path separators or '..'", name)
+	}
+
+	if strings.EqualFold(name, keystoreName) {
+		return stacktrace.NewErrorWithCode(exitcode.Usage, "invalid profile name '%v'. The name is reserved for the keystore", name)
+	}
+
+	return nil
+}
+
+func readProfile(homePath, name string) (map[string]interface{}, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(profilePath(homePath, name))
+
+	if os.IsNotExist(err) {
+		return nil, stacktrace.NewErrorWithCode(exitcode.NotFound, "no such profile '%v'", name)
+	}
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to read profile %v", name)
+	}
+
+	profile := map[string]interface{}{}
+
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return nil, stacktrace.Propagate(err, "failed to parse profile %v", name)
+	}
+
+	return profile, nil
+}
+
+// loadProfile reads the settings of a profile other than the loaded one.
+// Environment overrides only apply to the loaded profile and are ignored.
+func loadProfile(homePath, name string) (*cliconfig, error) {
+	values, err := readProfile(homePath, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	jsonb, err := json.Marshal(values)
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to encode profile %v", name)
+	}
+
+	profile := &cliconfig{}
+
+	if err := json.Unmarshal(jsonb, profile); err != nil {
+		return nil, stacktrace.Propagate(err, "failed to parse profile %v", name)
+	}
+
+	return profile, nil
+}
+
+func saveProfile(path string, profile map[string]interface{}) error {
+	jsonb, err := json.MarshalIndent(profile, "", "    ")
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to encode profile %v", path)
+	}
+
+	if err := ioutil.WriteFile(path, jsonb, 0600); err != nil {
+		return stacktrace.Propagate(err, "failed to write profile %v", path)
+	}
+
+	return nil
+}
+
+type listedProfile struct {
+	Name     string `json:"name"`
+	Selected bool   `json:"selected"`
+}
+
+func listProfiles(homePath string, out *output.Renderer) error {
+	names, err := profileNames(homePath)
+
+	if err != nil {
+		return err
+	}
+
+	// The table marks the selected profile with an asterisk.
+	out.Text(func(w io.Writer, value interface{}) error {
+		profile := value.(*listedProfile)
+		marker := " "
+
+		if profile.Selected {
+			marker = "*"
+		}
+
+		_, err := fmt.Fprintf(w, "%v %v\n", marker, profile.Name)
+		return err
+	})
+
+	for _, name := range names {
+		if err := out.Add(&listedProfile{Name: name, Selected: name == *cliProfile}); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
+
+func showProfile(homePath, name string, out *output.Renderer) error {
+	if name == "" {
+		name = *cliProfile
+	}
+
+	profile, err := readProfile(homePath, name)
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range profileSecretKeys {
+		if value, ok := profile[key].(string); ok && value != "" && !secret.IsReference(value) {
+			profile[key] = "REDACTED"
+		}
+	}
+
+	return out.Render(profile)
+}
+
+func useProfile(homePath, name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	if _, err := readProfile(homePath, name); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(homePath, defaultProfileFile), []byte(name), 0600); err != nil {
+		return stacktrace.Propagate(err, "failed to save default profile")
+	}
+
+	fmt.Printf("Using profile '%v' by default\n", name)
+
+	return nil
+}
+
+func copyProfile(homePath, source, dest string) error {
+	if err := validateProfileName(dest); err != nil {
+		return err
+	}
+
+	profile, err := readProfile(homePath, source)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(profilePath(homePath, dest)); err == nil {
+		return stacktrace.NewErrorWithCode(exitcode.Usage, "profile '%v' already exists", dest)
+	}
+
+	// Secrets the source stored itself are stored again for the copy, so
+	// reconfiguring or deleting either profile leaves the other intact.
+	for _, key := range profileSecretKeys {
+		value, _ := profile[key].(string)
+		scheme, owned := ownedSecret(source, key, value)
+
+		if !owned {
+			continue
+		}
+
+		plaintext, err := secret.Resolve(value)
+
+		if err != nil {
+			return stacktrace.Propagate(err, "failed to read %v of profile %v", key, source)
+		}
+
+		if profile[key], err = secret.Store(scheme, profileSecretName(dest, key), plaintext); err != nil {
+			return stacktrace.Propagate(err, "failed to store %v of profile %v", key, dest)
+		}
+	}
+
+	return saveProfile(profilePath(homePath, dest), profile)
+}
+
+func deleteProfile(homePath, name string, yes bool) error {
+	profile, err := readProfile(homePath, name)
+
+	if err != nil {
+		return err
+	}
+
+	if !yes && !prompter.YN(fmt.Sprintf("Delete profile '%v'?", name), false) {
+		return nil
+	}
+
+	for _, key := range profileSecretKeys {
+		value, _ := profile[key].(string)
+		scheme, owned := ownedSecret(name, key, value)
+
+		if !owned {
+			continue
+		}
+
+		if err := secret.Delete(scheme, profileSecretName(name, key)); err != nil {
+			return stacktrace.Propagate(err, "failed to delete %v of profile %v", key, name)
+		}
+	}
+
+	if err := os.Remove(profilePath(homePath, name)); err != nil {
+		return stacktrace.Propagate(err, "failed to delete profile %v", name)
+	}
+
+	if defaultProfile(homePath) == name {
+		os.Remove(filepath.Join(homePath, defaultProfileFile))
+	}
+
+	return nil
+}
+
+func validateProfileKey(key string) error {
+	for _, known := range profileKeys {
+		if key == known {
+			return nil
+		}
+	}
+
+	return stacktrace.NewErrorWithCode(exitcode.Usage, "unknown setting '%v'. Valid settings are: %v", key, strings.Join(profileKeys, ", "))
+}
+
+// setProfileValue writes a single setting to the profile file, converting it
+// to the type the setting is stored as.
+func setProfileValue(path, key, value string) error {
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to read profile %v", path)
+	}
+
+	profile := map[string]interface{}{}
+
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return stacktrace.Propagate(err, "failed to parse profile %v", path)
+	}
+
+	switch key {
+	case "hub_api_port":
+		port, err := strconv.Atoi(value)
+
+		if err != nil {
+			return stacktrace.NewErrorWithCode(exitcode.Usage, "%v must be a number", key)
+		}
+
+		profile[key] = port
+
+	case "hub_api_skip_cert_verify":
+		skip, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return stacktrace.NewErrorWithCode(exitcode.Usage, "%v must be true or false", key)
+		}
+
+		profile[key] = skip
+
+	case "hub_cert_sha256":
+		profile[key] = tlsconfig.NormalizeFingerprint(value)
+
+	default:
+		profile[key] = value
+	}
+
+	return saveProfile(path, profile)
+}
+
+// configureFromFlags is the non-interactive configure used by CI runners.
+// Settings without a flag keep the value in the profile file; environment
+// overrides are never written back.
+func configureFromFlags(homePath string) error {
+	profile, err := loadProfile(homePath, *cliProfile)
+
+	if err != nil {
+		return err
+	}
+
+	if *configHubAddr != "" {
+		profile.HubAddr = *configHubAddr
+	}
+
+	if *configHubPort != 0 {
+		profile.HubPort = *configHubPort
+	}
+
+	if *configUserID != "" {
+		profile.UserID = *configUserID
+	}
+
+	if *configKeyFile != "" {
+		if profile.UserPrivateKey, err = readSecretFile(*configKeyFile); err != nil {
+			return err
+		}
+	}
+
+	if *configTOTPFile != "" {
+		if profile.UserTOTPSecret, err = readSecretFile(*configTOTPFile); err != nil {
+			return err
+		}
+	}
+
+	if *configCAFile != "" {
+		profile.HubCAFile = *configCAFile
+	}
+
+	if *configCertSHA256 != "" {
+		profile.HubCertSHA256 = tlsconfig.NormalizeFingerprint(*configCertSHA256)
+	}
+
+	if *configClientCert != "" {
+		profile.ClientCertFile = *configClientCert
+	}
+
+	if *configClientKey != "" {
+		profile.ClientKeyFile = *configClientKey
+	}
+
+	// The keystore would prompt for its passphrase, which a CI runner
+	// cannot answer.
+	if *configSecretBackend == "keystore" && os.Getenv("DEVICEIO_KEYSTORE_PASSPHRASE") == "" {
+		for _, value := range []string{profile.UserPrivateKey, profile.UserTOTPSecret} {
+			if value != "" && !secret.IsReference(value) {
+				return stacktrace.NewErrorWithCode(exitcode.Usage, "storing secrets in the keystore without a prompt needs DEVICEIO_KEYSTORE_PASSPHRASE. Set it or pass --secret-backend secretservice or plain")
+			}
+		}
+	}
+
+	if err := storeProfileSecrets(profile, *configSecretBackend); err != nil {
+		return err
+	}
+
+	return writeProfile(profile)
+}
+
+func readSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return "", stacktrace.Propagate(err, "failed to read %v", path)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
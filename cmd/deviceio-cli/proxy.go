@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/hub"
+	"github.com/palantir/stacktrace"
+	"github.com/spf13/viper"
+)
+
+func proxy(homePath string) error {
+	if *hubProxyPort == 0 && *hubProxySocket == "" {
+		return stacktrace.NewErrorWithCode(exitcode.Usage, "either --port or --unix-socket is required")
+	}
+
+	if (*hubProxyCert == "") != (*hubProxyKey == "") {
+		return stacktrace.NewErrorWithCode(exitcode.Usage, "--cert and --key must be given together")
+	}
+
+	certFile, keyFile := *hubProxyCert, *hubProxyKey
+
+	if certFile == "" {
+		certFile = filepath.Join(homePath, "proxy", *cliProfile+".crt")
+		keyFile = filepath.Join(homePath, "proxy", *cliProfile+".key")
+	}
+
+	token := *hubProxyToken
+
+	if *hubProxyGenToken {
+		b := make([]byte, 32)
+
+		if _, err := rand.Read(b); err != nil {
+			return stacktrace.Propagate(err, "failed to generate a proxy token")
+		}
+
+		token = hex.EncodeToString(b)
+		fmt.Fprintf(os.Stderr, "Proxy token: %v\n", token)
+	}
+
+	hubTLS, err := hubTLSConfig()
+
+	if err != nil {
+		return err
+	}
+
+	transport, err := hubTransport()
+
+	if err != nil {
+		return err
+	}
+
+	clientAuth, err := userAuth()
+
+	if err != nil {
+		return err
+	}
+
+	upstreams, err := proxyUpstreams(homePath)
+
+	if err != nil {
+		return err
+	}
+
+	config := &hub.ProxyConfig{
+		HubHost:    viper.GetString("hub_api_addr"),
+		HubPort:    viper.GetInt("hub_api_port"),
+		HubTLS:     hubTLS,
+		Transport:  transport,
+		Auth:       clientAuth,
+		Bind:       *hubProxyBind,
+		Port:       *hubProxyPort,
+		UnixSocket: *hubProxySocket,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		Token:      token,
+		Upstreams:  upstreams,
+
+		HealthInterval: *hubProxyHealth,
+	}
+
+	if *hubProxyPolicy != "" {
+		policy, err := hub.LoadProxyPolicy(*hubProxyPolicy)
+
+		if err != nil {
+			return stacktrace.PropagateWithCode(err, exitcode.Usage, "")
+		}
+
+		config.Policy = policy
+	}
+
+	switch *hubProxyAccessLog {
+	case "":
+	case "-":
+		config.AccessLog = os.Stdout
+	default:
+		f, err := os.OpenFile(*hubProxyAccessLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+
+		if err != nil {
+			return stacktrace.Propagate(err, "failed to open access log %v", *hubProxyAccessLog)
+		}
+		defer f.Close()
+
+		config.AccessLog = f
+	}
+
+	return hub.Proxy(config)
+}
+
+// proxyUpstreams loads the profiles named by --route and --host-route.
+func proxyUpstreams(homePath string) ([]*hub.ProxyUpstream, error) {
+	upstreams := []*hub.ProxyUpstream{}
+
+	for _, prefix := range sortedKeys(*hubProxyRoutes) {
+		upstream, err := profileUpstream(homePath, (*hubProxyRoutes)[prefix])
+
+		if err != nil {
+			return nil, err
+		}
+
+		upstream.PathPrefix = prefix
+		upstreams = append(upstreams, upstream)
+	}
+
+	for _, host := range sortedKeys(*hubProxyHosts) {
+		upstream, err := profileUpstream(homePath, (*hubProxyHosts)[host])
+
+		if err != nil {
+			return nil, err
+		}
+
+		upstream.Host = host
+		upstreams = append(upstreams, upstream)
+	}
+
+	return upstreams, nil
+}
+
+func profileUpstream(homePath, name string) (*hub.ProxyUpstream, error) {
+	profile, err := loadProfile(homePath, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hubTLS, err := profileHubTLSConfig(profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := profileTransport(name, profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth, err := profileAuth(profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &hub.ProxyUpstream{
+		Name:      name,
+		HubHost:   profile.HubAddr,
+		HubPort:   profile.HubPort,
+		HubTLS:    hubTLS,
+		Transport: transport,
+		Auth:      clientAuth,
+	}, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Songmu/prompter"
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/secret"
+	sdk "github.com/deviceio/sdk/go-sdk"
+	"github.com/palantir/stacktrace"
+)
+
+var profileSecretKeys = []string{
+	"user_private_key",
+	"user_totp_secret",
+}
+
+// userAuth builds the hub request signer for the loaded profile.
+func userAuth() (*sdk.ClientAuth, error) {
+	return profileAuth(loadedProfile())
+}
+
+// profileAuth builds the hub request signer for a profile, resolving secret
+// references against their backends.
+func profileAuth(profile *cliconfig) (*sdk.ClientAuth, error) {
+	privateKey, err := secret.Resolve(profile.UserPrivateKey)
+
+	if err != nil {
+		return nil, stacktrace.PropagateWithCode(err, exitcode.AuthFailed, "failed to resolve user private key")
+	}
+
+	totpSecret, err := secret.Resolve(profile.UserTOTPSecret)
+
+	if err != nil {
+		return nil, stacktrace.PropagateWithCode(err, exitcode.AuthFailed, "failed to resolve user totp secret")
+	}
+
+	return &sdk.ClientAuth{
+		UserID:         profile.UserID,
+		UserTOTPSecret: totpSecret,
+		UserPrivateKey: privateKey,
+	}, nil
+}
+
+// keystorePassphrase returns the passphrase prompt of the keystore at path.
+// The passphrase of a new keystore is asked for twice, since a typo would
+// encrypt its secrets under a passphrase nobody knows.
+func keystorePassphrase(path string) func() (string, error) {
+	return func() (string, error) {
+		if passphrase := os.Getenv("DEVICEIO_KEYSTORE_PASSPHRASE"); passphrase != "" {
+			return passphrase, nil
+		}
+
+		passphrase := prompter.Password("Keystore Passphrase")
+
+		if passphrase == "" {
+			return "", stacktrace.NewErrorWithCode(exitcode.Usage, "a keystore passphrase is required")
+		}
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if prompter.Password("Confirm Keystore Passphrase") != passphrase {
+				return "", stacktrace.NewErrorWithCode(exitcode.Usage, "keystore passphrases do not match")
+			}
+		}
+
+		return passphrase, nil
+	}
+}
+
+func storeProfileSecrets(profile *cliconfig, backend string) error {
+	if backend == "plain" {
+		return nil
+	}
+
+	var err error
+
+	if profile.UserPrivateKey, err = storeProfileSecret(*cliProfile, "user_private_key", profile.UserPrivateKey, backend); err != nil {
+		return err
+	}
+
+	if profile.UserTOTPSecret, err = storeProfileSecret(*cliProfile, "user_totp_secret", profile.UserTOTPSecret, backend); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func storeProfileSecret(profile, key, value, backend string) (string, error) {
+	if value == "" || secret.IsReference(value) {
+		return value, nil
+	}
+
+	if backend == "secretservice" && !secret.SecretServiceAvailable() {
+		return "", stacktrace.NewError("the secret service is not available in this session")
+	}
+
+	ref, err := secret.Store(backend, profileSecretName(profile, key), value)
+
+	if err != nil {
+		return "", stacktrace.Propagate(err, "failed to store %v of profile %v", key, profile)
+	}
+
+	return ref, nil
+}
+
+// profileSecretName names the entry holding key of a profile in a backend.
+func profileSecretName(profile, key string) string {
+	return fmt.Sprintf("%v/%v", profile, key)
+}
+
+// ownedSecret returns the backend of value when it refers to the entry the
+// profile stored key in itself. References to secrets kept elsewhere may be
+// shared and belong to no profile.
+func ownedSecret(profile, key, value string) (string, bool) {
+	scheme, name, ok := secret.ParseReference(value)
+
+	if !ok || name != profileSecretName(profile, key) {
+		return "", false
+	}
+
+	return scheme, true
+}
+
+// migrateSecrets rewrites profiles so that plaintext secrets are replaced by
+// references into backend. Unknown profile keys are preserved as is.
+func migrateSecrets(homePath, backend string, all bool) error {
+	names := []string{*cliProfile}
+
+	if all {
+		var err error
+
+		if names, err = profileNames(homePath); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		profile, err := readProfile(homePath, name)
+
+		if err != nil {
+			return err
+		}
+
+		migrated := 0
+
+		for _, key := range profileSecretKeys {
+			value, _ := profile[key].(string)
+			ref, err := storeProfileSecret(name, key, value, backend)
+
+			if err != nil {
+				return err
+			}
+
+			if ref != value {
+				profile[key] = ref
+				migrated++
+			}
+		}
+
+		if migrated == 0 {
+			fmt.Printf("%v: nothing to migrate\n", name)
+			continue
+		}
+
+		if err := saveProfile(profilePath(homePath, name), profile); err != nil {
+			return err
+		}
+
+		if err := os.Chmod(profilePath(homePath, name), 0600); err != nil {
+			return stacktrace.Propagate(err, "failed to restrict profile %v", name)
+		}
+
+		fmt.Printf("%v: moved %v secret(s) to %v\n", name, migrated, backend)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/hub"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+// submitFields collects the typed --field flags of hub submit. Uploads are
+// added last so the other fields precede the streamed file content.
+func submitFields() ([]*hub.SubmitField, error) {
+	fields := []*hub.SubmitField{}
+
+	for _, flag := range []struct {
+		media hmapi.MediaType
+		args  []string
+	}{
+		{hmapi.MediaTypeHMAPIString, *hubSubmitFields},
+		{hmapi.MediaTypeHMAPIInt, *hubSubmitInts},
+		{hmapi.MediaTypeHMAPIBoolean, *hubSubmitBools},
+		{hmapi.MediaTypeOctetStream, *hubSubmitFiles},
+	} {
+		parsed, err := hub.ParseSubmitFields(flag.media, flag.args)
+
+		if err != nil {
+			return nil, stacktrace.PropagateWithCode(err, exitcode.Usage, "")
+		}
+
+		fields = append(fields, parsed...)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Songmu/prompter"
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/tlsconfig"
+	"github.com/palantir/stacktrace"
+)
+
+// hubTLSConfig returns the TLS settings of the loaded profile. The same
+// settings are used by the hmapi client, the sdk client and hub proxy.
+func hubTLSConfig() (*tls.Config, error) {
+	return profileHubTLSConfig(loadedProfile())
+}
+
+func profileHubTLSConfig(profile *cliconfig) (*tls.Config, error) {
+	config := profileTLSConfig(profile)
+
+	if config.SkipVerify {
+		logrus.WithField("hub", profile.HubAddr).Warn("hub certificate verification is disabled by hub_api_skip_cert_verify")
+	}
+
+	tlsconfig, err := config.TLSConfig()
+
+	if err != nil {
+		return nil, stacktrace.PropagateWithCode(err, exitcode.AuthFailed, "failed to load the TLS settings of hub %v", profile.HubAddr)
+	}
+
+	return tlsconfig, nil
+}
+
+func profileTLSConfig(profile *cliconfig) *tlsconfig.Config {
+	return &tlsconfig.Config{
+		SkipVerify:     profile.TLSSkipVerify,
+		CAFile:         profile.HubCAFile,
+		PinSHA256:      profile.HubCertSHA256,
+		ClientCertFile: profile.ClientCertFile,
+		ClientKeyFile:  profile.ClientKeyFile,
+	}
+}
+
+// trustHubCertificate implements trust on first use for hubs whose
+// certificate does not chain to a trusted authority. The hub's fingerprint is
+// shown and, once accepted, pinned in the profile.
+func trustHubCertificate(profile *cliconfig) error {
+	if profile.TLSSkipVerify {
+		return nil
+	}
+
+	addr := net.JoinHostPort(profile.HubAddr, strconv.Itoa(profile.HubPort))
+	chain, verified, err := tlsconfig.FetchCertificate(addr, profileTLSConfig(profile))
+
+	if err != nil {
+		logrus.WithField("error", err.Error()).Warn("Unable to fetch the hub certificate. Certificate trust was not updated")
+		return nil
+	}
+
+	fingerprint := tlsconfig.Fingerprint(chain[0])
+
+	if tlsconfig.NormalizeFingerprint(profile.HubCertSHA256) == fingerprint {
+		return nil
+	}
+
+	if verified && profile.HubCertSHA256 == "" {
+		return nil
+	}
+
+	if profile.HubCertSHA256 != "" {
+		fmt.Println("WARNING: the hub certificate no longer matches the pinned fingerprint")
+		fmt.Printf("Pinned Fingerprint:  %v\n", tlsconfig.FormatFingerprint(profile.HubCertSHA256))
+	}
+
+	fmt.Printf("Hub Certificate:     %v\n", chain[0].Subject.CommonName)
+	fmt.Printf("Issuer:              %v\n", chain[0].Issuer.CommonName)
+	fmt.Printf("Valid Until:         %v\n", chain[0].NotAfter)
+	fmt.Printf("SHA256 Fingerprint:  %v\n", tlsconfig.FormatFingerprint(fingerprint))
+
+	if !prompter.YN("Trust this certificate?", false) {
+		return stacktrace.NewErrorWithCode(exitcode.AuthFailed, "hub certificate was not trusted")
+	}
+
+	profile.HubCertSHA256 = fingerprint
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/deviceio/cli/transport"
+)
+
+var profileTransports = map[string]*http.Transport{}
+
+// hubTransport returns the transport of the loaded profile.
+func hubTransport() (*http.Transport, error) {
+	return profileTransport(*cliProfile, loadedProfile())
+}
+
+// profileTransport returns the transport shared by every connection the cli
+// makes to the hub of the named profile, so hmapi, sdk, curl and proxy
+// requests reuse the same pooled connections.
+func profileTransport(name string, profile *cliconfig) (*http.Transport, error) {
+	if t, ok := profileTransports[name]; ok {
+		return t, nil
+	}
+
+	tlsConfig, err := profileHubTLSConfig(profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := transport.New(&transport.Config{
+		TLS:             tlsConfig,
+		DialTimeout:     *cliConnectTimeout,
+		KeepAlive:       *cliKeepAlive,
+		MaxIdlePerHost:  *cliMaxIdleConns,
+		ResponseTimeout: *cliRequestTimeout,
+		DisableHTTP2:    !*cliHTTP2,
+	})
+
+	profileTransports[name] = t
+
+	return t, nil
+}
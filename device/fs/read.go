@@ -5,46 +5,43 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/deviceio/cli/exitcode"
 	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
 )
 
-func Read(deviceid, path string, c hmapi.Client) {
-	formResult, err := c.
+func Read(deviceid, path string, c hmapi.Client) error {
+	resp, err := c.
 		Resource(fmt.Sprintf("/device/%v/filesystem", deviceid)).
 		Form("read").
+		Idempotent().
 		AddFieldAsString("path", path).
 		Submit(context.Background())
 
 	if err != nil {
-		log.Fatal(err)
+		return stacktrace.Propagate(err, "failed to read %v", path)
 	}
 
-	resp := formResult
+	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
 		body, _ := ioutil.ReadAll(resp.Body)
-		logrus.WithFields(logrus.Fields{
-			"endpoint":     resp.Request.URL.Path,
-			"method":       resp.Request.Method,
-			"statusCode":   resp.StatusCode,
-			"responseBody": string(body),
-		}).Fatal("Error calling device endpoint")
+		return stacktrace.NewErrorWithCode(exitcode.FromStatus(resp.StatusCode), "failed to read %v: %v", path, exitcode.Response(resp.StatusCode, body))
 	}
 
-	defer func() {
-		if resp.Trailer.Get("Error") != "" {
-			os.Stderr.Write([]byte(resp.Trailer.Get("Error")))
-			os.Stderr.Sync()
-		}
-	}()
-
 	buf := make([]byte, 250000)
 
 	if _, err := io.CopyBuffer(os.Stdout, resp.Body, buf); err != nil {
-		os.Stderr.Write([]byte(err.Error()))
+		return stacktrace.PropagateWithCode(err, exitcode.TransferIncomplete, "failed to read %v", path)
+	}
+
+	// The device reports a read it could not finish in the Error trailer,
+	// which is only known once the body has been read.
+	if trailerError := resp.Trailer.Get("Error"); trailerError != "" {
+		return stacktrace.NewErrorWithCode(exitcode.TransferIncomplete, "failed to read %v: %v", path, trailerError)
 	}
+
+	return nil
 }
@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/deviceio/hmapi"
+)
+
+// TestReadIsRetried checks that fs:read, a POST form, is retried after the
+// hub answers 503 since reading a file is safe to repeat.
+func TestReadIsRetried(t *testing.T) {
+	reads := 0
+
+	hub := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			rw.Write([]byte(`{"forms":{"read":{"action":"/device/d1/filesystem/read","method":"POST","enctype":"application/x-www-form-urlencoded",
+				"fields":[{"name":"path","type":"application/vnd.hmapi.String","required":true}]}}}`))
+			return
+		}
+
+		ioutil.ReadAll(r.Body)
+		reads++
+
+		if reads == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		rw.Write([]byte("content"))
+	}))
+	defer hub.Close()
+
+	target, _ := url.Parse(hub.URL)
+	port, _ := strconv.Atoi(target.Port())
+
+	c := hmapi.NewClient(&hmapi.ClientConfig{
+		Host:  target.Hostname(),
+		Port:  port,
+		Retry: &hmapi.RetryPolicy{MaxRetries: 2, BaseWait: time.Millisecond},
+	})
+
+	out, err := ioutil.TempFile("", "read")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	stdout := os.Stdout
+	os.Stdout = out
+	err = Read("d1", "/etc/hostname", c)
+	os.Stdout = stdout
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reads != 2 {
+		t.Errorf("expected the read to be sent twice, got %v", reads)
+	}
+
+	if content, _ := ioutil.ReadFile(out.Name()); string(content) != "content" {
+		t.Errorf("expected the file content, got %q", content)
+	}
+}
@@ -2,73 +2,44 @@ package fs
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"os"
 
-	"github.com/Sirupsen/logrus"
-	"github.com/deviceio/hmapi"
+	"github.com/deviceio/cli/exitcode"
+	sdk "github.com/deviceio/sdk/go-sdk"
+	"github.com/palantir/stacktrace"
 )
 
-func Write(deviceid, path string, append bool, c hmapi.Client) {
-	datar, dataw := io.Pipe()
-	done := make(chan bool)
+func Write(deviceid, path string, append bool, c sdk.Client) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	go func() {
-		defer dataw.Close()
-		defer datar.Close()
+	writer := c.Device(deviceid).Filesystem().Writer(ctx, path, append)
 
-		buf := make([]byte, 250000)
+	buf := make([]byte, 250000)
 
-		for {
-			nr, rerr := os.Stdin.Read(buf)
+	if _, err := io.CopyBuffer(writer, os.Stdin, buf); err != nil {
+		// Cancelling aborts the request so the device does not keep a
+		// truncated file.
+		cancel()
+		return stacktrace.PropagateWithCode(err, writeCode(err), "failed to write %v", path)
+	}
 
-			if rerr != nil && rerr != io.EOF {
-				logrus.Fatal(rerr)
-			}
+	// Close waits for the device to confirm the write, which is when a
+	// failure on its side is known.
+	if err := writer.Close(); err != nil {
+		return stacktrace.PropagateWithCode(err, writeCode(err), "failed to write %v", path)
+	}
 
-			if rerr != nil && rerr == io.EOF {
-				break
-			}
-
-			if nr > 0 || rerr == io.EOF {
-				dataw.Write(buf[:nr])
-				continue
-			}
-
-			break
-		}
-	}()
-
-	go func() {
-		formResult, err := c.
-			Resource(fmt.Sprintf("/device/%v/filesystem", deviceid)).
-			Form("write").
-			AddFieldAsString("path", path).
-			AddFieldAsBool("append", append).
-			AddFieldAsOctetStream("data", datar).
-			Submit(context.Background())
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		resp := formResult
-
-		if resp.StatusCode >= 300 {
-			body, _ := ioutil.ReadAll(resp.Body)
-			logrus.WithFields(logrus.Fields{
-				"endpoint":     resp.Request.URL.Path,
-				"method":       resp.Request.Method,
-				"statusCode":   resp.StatusCode,
-				"responseBody": string(body),
-			}).Fatal("Error calling device endpoint")
-		}
+	return nil
+}
 
-		close(done)
-	}()
+// writeCode classifies a failed write. Requests the hub rejected keep the
+// kind of their status; anything else left the file incomplete.
+func writeCode(err error) stacktrace.ErrorCode {
+	if code := exitcode.Code(err); code != exitcode.General {
+		return code
+	}
 
-	<-done
+	return exitcode.TransferIncomplete
 }
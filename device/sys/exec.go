@@ -2,23 +2,30 @@ package sys
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 
 	"sync"
 
+	"github.com/deviceio/cli/exitcode"
 	sdk "github.com/deviceio/sdk/go-sdk"
+	"github.com/palantir/stacktrace"
 )
 
-func Exec(deviceid, cmd string, args []string, c sdk.Client) {
+// Exec runs cmd on the device and returns the exit code of the process. An
+// error means the process could not be run or followed to its end.
+func Exec(deviceid, cmd string, args []string, c sdk.Client) (int, error) {
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	process, err := c.Device(deviceid).Process().Create(ctx, cmd, args)
 
 	if err != nil {
-		panic(err.Error())
+		return 0, stacktrace.PropagateWithCode(err, execCode(err), "failed to create process %v", cmd)
 	}
 
 	cleanup := func() {
@@ -27,10 +34,80 @@ func Exec(deviceid, cmd string, args []string, c sdk.Client) {
 			log.Println("error destroying process:", err.Error())
 		}
 	}
+
 	defer cleanup()
 
+	stream, err := process.Stream(ctx)
+
+	switch err.(type) {
+	case nil:
+		return execStream(stream)
+	case *sdk.ErrProcessStreamUnsupported:
+		// Scripts must not take the 0 returned for these agents as success.
+		fmt.Fprintf(os.Stderr, "%v: warning: the agent does not report exit codes, so exec exits with 0 unless a request fails\n", filepath.Base(os.Args[0]))
+		return execLinks(ctx, cancel, process)
+	default:
+		return 0, stacktrace.PropagateWithCode(err, execCode(err), "failed to start process %v", cmd)
+	}
+}
+
+// execCode classifies a failed exec. Requests the hub rejected keep the kind
+// of their status; anything else is a failure of the remote command.
+func execCode(err error) stacktrace.ErrorCode {
+	if code := exitcode.Code(err); code != exitcode.General {
+		return code
+	}
+
+	return exitcode.RemoteCommandFailed
+}
+
+// execStream runs a process started over a multiplexed stream, which keeps
+// stdout and stderr in the order the process wrote them. The first interrupt
+// is forwarded to the process, a second one ends the stream.
+func execStream(stream sdk.DeviceProcessStream) (int, error) {
+	defer stream.Close()
+
+	go func() {
+		stdin := stream.Stdin()
+		io.CopyBuffer(stdin, os.Stdin, make([]byte, 250000))
+		stdin.Close()
+	}()
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt)
+	defer signal.Stop(sigch)
+
+	interrupted := make(chan struct{})
+
+	go func() {
+		<-sigch
+		stream.Signal("SIGINT")
+		<-sigch
+		close(interrupted)
+		stream.Close()
+	}()
+
+	code, err := stream.Output(os.Stdout, os.Stderr)
+
+	select {
+	case <-interrupted:
+		return 0, stacktrace.NewMessageWithCode(exitcode.Interrupted, "interrupted")
+	default:
+	}
+
+	if err != nil {
+		return 0, stacktrace.PropagateWithCode(err, execCode(err), "process stream failed")
+	}
+
+	return code, nil
+}
+
+// execLinks runs a process through the start form and the stdin, stdout and
+// stderr links, for agents without multiplexed streams. The exit code of the
+// process is not known this way, so it returns 0 unless a request failed.
+func execLinks(ctx context.Context, cancel context.CancelFunc, process sdk.DeviceProcessInstance) (int, error) {
 	data := &sync.WaitGroup{}
-	done := make(chan bool)
+	done := make(chan bool, 1)
 	stdin := process.Stdin(ctx)
 	stdout := process.Stdout(ctx)
 	stderr := process.Stderr(ctx)
@@ -39,8 +116,21 @@ func Exec(deviceid, cmd string, args []string, c sdk.Client) {
 	stderrbuf := make([]byte, 250000)
 	stdinbuf := make([]byte, 250000)
 
+	// fail records the first error and cancels the remaining requests; the
+	// cancellation errors that follow are not recorded.
+	var failOnce sync.Once
+	var failed error
+
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failed = err
+			cancel()
+		})
+	}
+
+	data.Add(2)
+
 	go func() {
-		data.Add(1)
 		for {
 			n, err := stdout.Read(stdoutbuf)
 
@@ -50,7 +140,7 @@ func Exec(deviceid, cmd string, args []string, c sdk.Client) {
 
 			if err != nil {
 				if err != io.EOF {
-					cancel()
+					fail(stacktrace.PropagateWithCode(err, execCode(err), "failed to read process stdout"))
 				}
 
 				break
@@ -60,7 +150,6 @@ func Exec(deviceid, cmd string, args []string, c sdk.Client) {
 	}()
 
 	go func() {
-		data.Add(1)
 		for {
 			n, err := stderr.Read(stderrbuf)
 
@@ -71,7 +160,7 @@ func Exec(deviceid, cmd string, args []string, c sdk.Client) {
 
 			if err != nil {
 				if err != io.EOF {
-					cancel()
+					fail(stacktrace.PropagateWithCode(err, execCode(err), "failed to read process stderr"))
 				}
 
 				break
@@ -85,23 +174,30 @@ func Exec(deviceid, cmd string, args []string, c sdk.Client) {
 			n, err := os.Stdin.Read(stdinbuf)
 
 			if n > 0 {
-				stdin.Write(stdinbuf[:n])
+				if _, werr := stdin.Write(stdinbuf[:n]); werr != nil {
+					fail(stacktrace.PropagateWithCode(werr, execCode(werr), "failed to write process stdin"))
+					return
+				}
 			}
 
-			if err != nil {
-				if err != io.EOF {
-					cancel()
+			if err == io.EOF {
+				// Closing waits for the device to take all of stdin.
+				if cerr := stdin.Close(); cerr != nil {
+					fail(stacktrace.PropagateWithCode(cerr, execCode(cerr), "failed to write process stdin"))
 				}
 
-				break
+				return
+			}
+
+			if err != nil {
+				fail(stacktrace.Propagate(err, "failed to read stdin"))
+				return
 			}
 		}
 	}()
 
-	err = process.Start(ctx)
-
-	if err != nil {
-		cancel()
+	if err := process.Start(ctx); err != nil {
+		fail(stacktrace.PropagateWithCode(err, execCode(err), "failed to start process"))
 	}
 
 	go func() {
@@ -111,14 +207,20 @@ func Exec(deviceid, cmd string, args []string, c sdk.Client) {
 
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, os.Interrupt)
+	defer signal.Stop(sigch)
 
 	select {
 	case <-ctx.Done():
-		log.Fatal(ctx.Err())
 	case <-done:
-		return
 	case <-sigch:
-		log.Println("interrupt")
-		cleanup()
+		// Cancelling ends the stdin, stdout and stderr requests before the
+		// process is deleted.
+		fail(stacktrace.NewMessageWithCode(exitcode.Interrupted, "interrupted"))
 	}
+
+	// A failure also ends the output streams. Do returns once the failing
+	// call has finished, so failed is set whenever ctx was cancelled.
+	failOnce.Do(func() {})
+
+	return 0, failed
 }
@@ -0,0 +1,126 @@
+// Package exitcode defines the kinds of errors commands fail with and the
+// exit code of each. The kind travels with an error as its stacktrace error
+// code, so an error created or propagated with one of these codes makes the
+// cli exit with it.
+package exitcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/deviceio/cli/tlsconfig"
+	"github.com/deviceio/hmapi"
+	sdk "github.com/deviceio/sdk/go-sdk"
+	"github.com/palantir/stacktrace"
+)
+
+const (
+	// General is a failure of no more specific kind.
+	General stacktrace.ErrorCode = 1
+
+	// Usage is an invalid command line, setting or form value.
+	Usage stacktrace.ErrorCode = 2
+
+	// NotFound is a profile, resource, link, form, content value or file
+	// that does not exist.
+	NotFound stacktrace.ErrorCode = 3
+
+	// AuthFailed is a request the hub rejected as unauthenticated or
+	// forbidden, or a hub whose certificate could not be trusted.
+	AuthFailed stacktrace.ErrorCode = 4
+
+	// DeviceOffline is a request the hub could not pass on to the device.
+	DeviceOffline stacktrace.ErrorCode = 5
+
+	// RemoteCommandFailed is a process the device could not create, start or
+	// stream.
+	RemoteCommandFailed stacktrace.ErrorCode = 6
+
+	// TransferIncomplete is a file or stream the device stopped sending or
+	// receiving part way through.
+	TransferIncomplete stacktrace.ErrorCode = 7
+
+	// Interrupted is a command ended by Ctrl-C.
+	Interrupted stacktrace.ErrorCode = 130
+
+	// ExecFailed is any failure of device exec itself rather than of the
+	// remote process. exec exits with the remote process's exit code, which
+	// may be any of the codes above, so like ssh it reports its own
+	// failures with this one code and tells them apart on stderr.
+	ExecFailed stacktrace.ErrorCode = 255
+)
+
+// FromStatus returns the kind of failure a hub response status reports.
+func FromStatus(status int) stacktrace.ErrorCode {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return Usage
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return AuthFailed
+	case http.StatusNotFound, http.StatusGone:
+		return NotFound
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return DeviceOffline
+	}
+
+	return General
+}
+
+// Code returns the kind of err. Errors without a kind are classified by the
+// hmapi, sdk or tls error that caused them.
+func Code(err error) stacktrace.ErrorCode {
+	if code := stacktrace.GetCode(err); code != stacktrace.NoCode {
+		return code
+	}
+
+	cause := stacktrace.RootCause(err)
+
+	var status *hmapi.ErrUnexpectedHTTPResponseStatus
+	var response *sdk.ErrInvalidAPIResponse
+	var noLink *hmapi.ErrResourceNoSuchLink
+	var noForm *hmapi.ErrResourceNoSuchForm
+	var noContent *hmapi.ErrResourceNoSuchContent
+	var validation *hmapi.ErrFormValidation
+	var valueType *hmapi.ErrFieldValueType
+	var process *sdk.ErrProcessStream
+	var device *sdk.ErrDeviceFailure
+	var pin *tlsconfig.ErrPinMismatch
+
+	switch {
+	case errors.As(cause, &status):
+		return FromStatus(status.ActualStatus)
+	case errors.As(cause, &response):
+		return FromStatus(response.StatusCode)
+	case errors.As(cause, &noLink), errors.As(cause, &noForm), errors.As(cause, &noContent):
+		return NotFound
+	case errors.As(cause, &validation), errors.As(cause, &valueType):
+		return Usage
+	case errors.As(cause, &process):
+		return RemoteCommandFailed
+	case errors.As(cause, &device):
+		return TransferIncomplete
+	case errors.As(cause, &pin):
+		return AuthFailed
+	}
+
+	return General
+}
+
+// Of returns the exit code of err.
+func Of(err error) int {
+	return int(Code(err))
+}
+
+// Response describes a failed hub response in one line, such as
+// "404 Not Found: no such file".
+func Response(status int, body []byte) string {
+	text := fmt.Sprintf("%v %v", status, http.StatusText(status))
+
+	if message := strings.Join(strings.Fields(string(body)), " "); message != "" {
+		text += ": " + message
+	}
+
+	return text
+}
@@ -0,0 +1,129 @@
+package exitcode
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/deviceio/cli/tlsconfig"
+	"github.com/deviceio/hmapi"
+	sdk "github.com/deviceio/sdk/go-sdk"
+	"github.com/palantir/stacktrace"
+)
+
+func TestFromStatus(t *testing.T) {
+	cases := map[int]stacktrace.ErrorCode{
+		http.StatusBadRequest:          Usage,
+		http.StatusUnprocessableEntity: Usage,
+		http.StatusUnauthorized:        AuthFailed,
+		http.StatusForbidden:           AuthFailed,
+		http.StatusNotFound:            NotFound,
+		http.StatusGone:                NotFound,
+		http.StatusBadGateway:          DeviceOffline,
+		http.StatusServiceUnavailable:  DeviceOffline,
+		http.StatusGatewayTimeout:      DeviceOffline,
+		http.StatusInternalServerError: General,
+		http.StatusConflict:            General,
+	}
+
+	for status, expected := range cases {
+		if code := FromStatus(status); code != expected {
+			t.Errorf("%v: expected %v, got %v", status, expected, code)
+		}
+	}
+}
+
+// TestCode checks that errors are classified by their cause when propagated
+// without a code, and by the code they were propagated with otherwise.
+func TestCode(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{
+			name:     "hmapi status",
+			err:      &hmapi.ErrUnexpectedHTTPResponseStatus{ExpectedStatus: http.StatusOK, ActualStatus: http.StatusNotFound},
+			expected: 3,
+		},
+		{
+			name:     "sdk status",
+			err:      &sdk.ErrInvalidAPIResponse{StatusCode: http.StatusForbidden},
+			expected: 4,
+		},
+		{
+			name:     "no such link",
+			err:      &hmapi.ErrResourceNoSuchLink{Resource: "/device", LinkName: "d1"},
+			expected: 3,
+		},
+		{
+			name:     "form validation",
+			err:      &hmapi.ErrFormValidation{Resource: "/device/d1", FormName: "upload"},
+			expected: 2,
+		},
+		{
+			name:     "process stream",
+			err:      &sdk.ErrProcessStream{Message: "no stdout"},
+			expected: 6,
+		},
+		{
+			name:     "device failure",
+			err:      &sdk.ErrDeviceFailure{Message: "disk full"},
+			expected: 7,
+		},
+		{
+			name:     "pin mismatch",
+			err:      &tlsconfig.ErrPinMismatch{Expected: "a", Actual: "b"},
+			expected: 4,
+		},
+		{
+			name:     "unclassified",
+			err:      errors.New("failed"),
+			expected: 1,
+		},
+		{
+			name:     "propagated cause",
+			err:      stacktrace.Propagate(&sdk.ErrDeviceFailure{Message: "disk full"}, "reading /etc/motd"),
+			expected: 7,
+		},
+		{
+			name:     "propagated code",
+			err:      stacktrace.PropagateWithCode(&sdk.ErrDeviceFailure{Message: "disk full"}, NotFound, ""),
+			expected: 3,
+		},
+		{
+			name:     "interrupted",
+			err:      stacktrace.NewMessageWithCode(Interrupted, "interrupted"),
+			expected: 130,
+		},
+		{
+			name:     "exec failed",
+			err:      stacktrace.PropagateWithCode(stacktrace.NewMessageWithCode(Interrupted, "interrupted"), ExecFailed, ""),
+			expected: 255,
+		},
+	}
+
+	for _, c := range cases {
+		if code := Of(c.err); code != c.expected {
+			t.Errorf("%v: expected %v, got %v", c.name, c.expected, code)
+		}
+	}
+}
+
+func TestResponse(t *testing.T) {
+	cases := []struct {
+		status   int
+		body     string
+		expected string
+	}{
+		{status: http.StatusNotFound, body: "no such file\n", expected: "404 Not Found: no such file"},
+		{status: http.StatusBadGateway, body: "device  d1\n  offline", expected: "502 Bad Gateway: device d1 offline"},
+		{status: http.StatusForbidden, expected: "403 Forbidden"},
+	}
+
+	for _, c := range cases {
+		if text := Response(c.status, []byte(c.body)); text != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, text)
+		}
+	}
+}
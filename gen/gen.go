@@ -0,0 +1,443 @@
+// Package gen generates typed Go wrappers for hmapi resources from the
+// resource graph exported by hub crawl.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/deviceio/cli/hub"
+	"github.com/deviceio/hmapi"
+)
+
+// Generate returns the source of a Go package with a type per resource of
+// graph that defines forms or links to other resources. Resources of the same
+// shape, such as the same resource of two devices, share a type.
+func Generate(graph *hub.Graph, pkg string) ([]byte, error) {
+	resources := resourceTypes(graph)
+
+	var buf bytes.Buffer
+
+	if err := sourceTemplate.Execute(&buf, &source{
+		Package:   pkg,
+		Root:      graph.Root,
+		Resources: resources,
+		Imports:   imports(resources),
+	}); err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid source: %v", err)
+	}
+
+	return src, nil
+}
+
+type source struct {
+	Package   string
+	Root      string
+	Resources []*resourceType
+	Imports   []string
+}
+
+type resourceType struct {
+	Name  string
+	Path  string
+	Forms []*formType
+	Links []*linkAccessor
+
+	resource *hub.GraphResource
+}
+
+type formType struct {
+	Name     string
+	Method   string
+	FormName string
+	Fields   []*fieldType
+}
+
+type fieldType struct {
+	Name      string
+	FieldName string
+	GoType    string
+	Add       string
+	Required  bool
+	Multiple  bool
+}
+
+type linkAccessor struct {
+	Name   string
+	Suffix string
+	Type   string
+}
+
+func resourceTypes(graph *hub.Graph) []*resourceType {
+	ids := collectIDs(graph)
+
+	// Resources are named after the link they were reached by, so a device's
+	// filesystem is named Filesystem regardless of the device id in its path.
+	linkNames := map[string]string{}
+
+	for _, resource := range graph.Resources {
+		for _, name := range sortedKeys(resource.Links) {
+			href := resource.Links[name].Href
+
+			if _, ok := linkNames[href]; !ok && href != resource.Path {
+				linkNames[href] = name
+			}
+		}
+	}
+
+	byPath := map[string]*resourceType{}
+	byName := map[string][]*resourceType{}
+	types := []*resourceType{}
+
+	for _, resource := range graph.Resources {
+		if resource.Error != "" || len(resource.Forms) == 0 && !hasNamedLinks(resource, ids) {
+			continue
+		}
+
+		name := resourceName(resource.Path, linkNames[resource.Path], ids)
+
+		rt := newResourceType(name, resource)
+
+		for _, existing := range byName[name] {
+			if reflect.DeepEqual(existing.Forms, rt.Forms) && sameLinks(existing.resource, resource) {
+				rt = existing
+				break
+			}
+		}
+
+		if rt.resource == resource {
+			if n := len(byName[name]); n > 0 {
+				rt.Name = fmt.Sprintf("%v%v", name, n+1)
+			}
+
+			byName[name] = append(byName[name], rt)
+			types = append(types, rt)
+		}
+
+		byPath[resource.Path] = rt
+	}
+
+	for _, rt := range types {
+		rt.Links = linkAccessors(rt, byPath, ids)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+
+	return types
+}
+
+func newResourceType(name string, resource *hub.GraphResource) *resourceType {
+	rt := &resourceType{
+		Name:     name,
+		Path:     resource.Path,
+		Forms:    []*formType{},
+		resource: resource,
+	}
+
+	for _, formName := range sortedKeys(resource.Forms) {
+		form := &formType{
+			Name:     name + goName(formName) + "Form",
+			Method:   goName(formName),
+			FormName: formName,
+			Fields:   []*fieldType{},
+		}
+
+		for _, field := range resource.Forms[formName].Fields {
+			form.Fields = append(form.Fields, newFieldType(field))
+		}
+
+		rt.Forms = append(rt.Forms, form)
+	}
+
+	return rt
+}
+
+// newFieldType maps a form field to a Go type. Required fields are always
+// added to the submission; optional fields are pointers, or nil slices and
+// readers, and only added when set.
+func newFieldType(field *hmapi.FormField) *fieldType {
+	ft := &fieldType{
+		Name:      goName(field.Name),
+		FieldName: field.Name,
+		Required:  field.Required,
+		Multiple:  field.Multiple,
+	}
+
+	if goType, ok := fieldGoTypes[field.Type]; ok {
+		ft.GoType, ft.Add = goType[0], goType[1]
+	} else {
+		ft.GoType, ft.Add = "string", "AddFieldAsString"
+	}
+
+	return ft
+}
+
+// fieldGoTypes maps hmapi media types to a Go type and the FormRequest method
+// adding a value of that type.
+var fieldGoTypes = map[hmapi.MediaType][2]string{
+	hmapi.MediaTypeHMAPIBoolean: {"bool", "AddFieldAsBool"},
+	hmapi.MediaTypeHMAPIInt:     {"int", "AddFieldAsInt"},
+	hmapi.MediaTypeHMAPIInt32:   {"int32", "AddFieldAsInt32"},
+	hmapi.MediaTypeHMAPIInt64:   {"int64", "AddFieldAsInt64"},
+	hmapi.MediaTypeHMAPIUInt:    {"uint", "AddFieldAsUInt"},
+	hmapi.MediaTypeHMAPIUInt32:  {"uint32", "AddFieldAsUInt32"},
+	hmapi.MediaTypeHMAPIUInt64:  {"uint64", "AddFieldAsUInt64"},
+	hmapi.MediaTypeHMAPIFloat32: {"float32", "AddFieldAsFloat32"},
+	hmapi.MediaTypeHMAPIFloat64: {"float64", "AddFieldAsFloat64"},
+	hmapi.MediaTypeOctetStream:  {"io.Reader", "AddFieldAsOctetStream"},
+	hmapi.MediaTypeHMAPIString:  {"string", "AddFieldAsString"},
+}
+
+// FieldType is the Go type of the field in its form struct.
+func (t *fieldType) FieldType() string {
+	switch {
+	case t.Multiple:
+		return "[]" + t.GoType
+	case t.Required || t.GoType == "io.Reader":
+		return t.GoType
+	default:
+		return "*" + t.GoType
+	}
+}
+
+// Optional reports whether the field is only added when set.
+func (t *fieldType) Optional() bool {
+	return !t.Required && !t.Multiple
+}
+
+// Nilable reports whether an unset optional field is nil.
+func (t *fieldType) Nilable() bool {
+	return t.GoType == "io.Reader" || t.Optional()
+}
+
+// Deref is the expression adding an optional field's value.
+func (t *fieldType) Deref() string {
+	if t.GoType == "io.Reader" {
+		return ""
+	}
+
+	return "*"
+}
+
+// linkAccessors returns accessors for links whose target has a type and
+// whose href extends the resource's path by the same suffix in every
+// resource sharing the type.
+func linkAccessors(rt *resourceType, byPath map[string]*resourceType, ids map[string]bool) []*linkAccessor {
+	accessors := []*linkAccessor{}
+	methods := map[string]bool{}
+
+	for _, form := range rt.Forms {
+		methods[form.Method] = true
+	}
+
+	for _, name := range sortedKeys(rt.resource.Links) {
+		href := rt.resource.Links[name].Href
+		target, ok := byPath[href]
+
+		if !ok || !strings.HasPrefix(href, strings.TrimSuffix(rt.Path, "/")+"/") {
+			continue
+		}
+
+		if ids[name] {
+			continue
+		}
+
+		accessor := &linkAccessor{
+			Name:   goName(name),
+			Suffix: strings.TrimPrefix(href, strings.TrimSuffix(rt.Path, "/")),
+			Type:   target.Name,
+		}
+
+		if methods[accessor.Name] {
+			accessor.Name += "Link"
+		}
+
+		methods[accessor.Name] = true
+		accessors = append(accessors, accessor)
+	}
+
+	return accessors
+}
+
+func sameLinks(a, b *hub.GraphResource) bool {
+	if len(a.Links) != len(b.Links) {
+		return false
+	}
+
+	for name, link := range a.Links {
+		other, ok := b.Links[name]
+
+		if !ok || other.Type != link.Type || strings.TrimPrefix(other.Href, b.Path) != strings.TrimPrefix(link.Href, a.Path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func imports(resources []*resourceType) []string {
+	imports := []string{"context"}
+
+	for _, rt := range resources {
+		for _, form := range rt.Forms {
+			for _, field := range form.Fields {
+				if field.GoType == "io.Reader" {
+					return []string{"context", "io"}
+				}
+			}
+		}
+	}
+
+	return imports
+}
+
+// goName converts an hmapi name such as public_key or read-file into an
+// exported Go identifier.
+func goName(name string) string {
+	var b strings.Builder
+
+	upper := true
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteString("F")
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// resourceName names a resource after the link it was reached by or else its
+// last path segment. Ids are skipped in favour of the segment before them, so
+// /device/4b0b1f3e is named Device.
+func resourceName(path, linkName string, ids map[string]bool) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if linkName != "" && !ids[linkName] {
+		segments = append(segments, linkName)
+	}
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		if name := goName(segments[i]); name != "" && !ids[segments[i]] {
+			return name
+		}
+	}
+
+	return "Root"
+}
+
+// collectIDs returns the link names and path segments that are ids rather
+// than names. Ids are the names of the links of a list resource: a resource
+// linking to at least two children at its own path plus the link name, all
+// of the same shape, as /device links to each device by its id.
+//
+// No list leads to the root of a crawl, so the device id of a root at
+// /device/<device-id>, as hub crawl --device starts from, is added as well.
+func collectIDs(graph *hub.Graph) map[string]bool {
+	ids := map[string]bool{}
+	byPath := map[string]*hub.GraphResource{}
+
+	for _, resource := range graph.Resources {
+		byPath[resource.Path] = resource
+	}
+
+	for _, resource := range graph.Resources {
+		children := []string{}
+		var shape *hub.GraphResource
+
+		for _, name := range sortedKeys(resource.Links) {
+			link := resource.Links[name]
+
+			if link.Type != hmapi.MediaTypeHMAPIResource {
+				continue
+			}
+
+			target, ok := byPath[link.Href]
+
+			if !ok || link.Href != strings.TrimSuffix(resource.Path, "/")+"/"+name {
+				children = nil
+				break
+			}
+
+			if shape == nil {
+				shape = target
+			} else if !sameShape(shape, target) {
+				children = nil
+				break
+			}
+
+			children = append(children, name)
+		}
+
+		if len(children) < 2 {
+			continue
+		}
+
+		for _, name := range children {
+			ids[name] = true
+		}
+	}
+
+	if segments := strings.Split(strings.Trim(graph.Root, "/"), "/"); len(segments) > 1 && segments[0] == "device" {
+		ids[segments[1]] = true
+	}
+
+	return ids
+}
+
+// sameShape reports whether two resources have the same forms and link
+// names, as the entries of a list do.
+func sameShape(a, b *hub.GraphResource) bool {
+	return reflect.DeepEqual(sortedKeys(a.Links), sortedKeys(b.Links)) &&
+		reflect.DeepEqual(sortedKeys(a.Content), sortedKeys(b.Content)) &&
+		reflect.DeepEqual(sortedKeys(a.Forms), sortedKeys(b.Forms))
+}
+
+// hasNamedLinks reports whether a resource links to other resources by name
+// rather than only listing resources by id.
+func hasNamedLinks(resource *hub.GraphResource, ids map[string]bool) bool {
+	for name, link := range resource.Links {
+		if link.Type == hmapi.MediaTypeHMAPIResource && !ids[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
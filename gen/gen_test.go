@@ -0,0 +1,138 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deviceio/cli/hub"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The source importer is shared so hmapi is only type checked once.
+	imports := importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+	for _, input := range inputs {
+		content, err := ioutil.ReadFile(input)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		graph := &hub.Graph{}
+
+		if err := json.Unmarshal(content, graph); err != nil {
+			t.Fatalf("%v: %v", input, err)
+		}
+
+		actual, err := Generate(graph, "client")
+
+		if err != nil {
+			t.Fatalf("%v: %v", input, err)
+		}
+
+		golden := strings.TrimSuffix(input, ".json") + ".golden"
+
+		if *update {
+			if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("%v: generated source differs from %v\n%s", input, golden, actual)
+		}
+
+		if err := typeCheck(imports, actual); err != nil {
+			t.Errorf("%v: generated source does not compile: %v", input, err)
+		}
+	}
+}
+
+// typeCheck type checks generated source as if it were a package next to
+// this one, so hmapi is imported from the same vendor directory.
+func typeCheck(imports types.Importer, src []byte) error {
+	dir, err := os.Getwd()
+
+	if err != nil {
+		return err
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filepath.Join(dir, "client", "client.go"), src, 0)
+
+	if err != nil {
+		return err
+	}
+
+	config := &types.Config{
+		Importer: imports,
+	}
+
+	_, err = config.Check("client", fset, []*ast.File{file}, nil)
+
+	return err
+}
+
+func TestGoName(t *testing.T) {
+	cases := map[string]string{
+		"read":          "Read",
+		"public_key":    "PublicKey",
+		"delay-seconds": "DelaySeconds",
+		"2fa":           "F2fa",
+		"/":             "",
+	}
+
+	for name, expected := range cases {
+		if actual := goName(name); actual != expected {
+			t.Errorf("goName(%q): expected %q, got %q", name, expected, actual)
+		}
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	cases := []struct {
+		path     string
+		link     string
+		expected string
+	}{
+		{"/", "", "Root"},
+		{"/device/4b0b1f3e", "", "Device"},
+		{"/device/4b0b1f3e", "4b0b1f3e", "Device"},
+		{"/device/4b0b1f3e/filesystem", "filesystem", "Filesystem"},
+		{"/device/4b0b1f3e/fs", "file-system", "FileSystem"},
+		{"/crypto/sha256", "sha256", "Sha256"},
+	}
+
+	ids := map[string]bool{"4b0b1f3e": true}
+
+	for _, c := range cases {
+		if actual := resourceName(c.path, c.link, ids); actual != c.expected {
+			t.Errorf("resourceName(%q, %q): expected %q, got %q", c.path, c.link, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package gen
+
+import "text/template"
+
+var sourceTemplate = template.Must(template.New("source").Parse(`// Code generated by deviceio-cli gen from the hmapi resources under {{.Root}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+
+	"github.com/deviceio/hmapi"
+)
+{{range $rt := .Resources}}
+// {{.Name}} wraps the hmapi resource found at {{.Path}}.
+type {{.Name}} struct {
+	client hmapi.Client
+	path   string
+}
+
+// New{{.Name}} returns a {{.Name}} for the resource at path.
+func New{{.Name}}(client hmapi.Client, path string) *{{.Name}} {
+	return &{{.Name}}{
+		client: client,
+		path:   path,
+	}
+}
+
+// Path returns the path of the resource.
+func (t *{{.Name}}) Path() string {
+	return t.path
+}
+{{range .Links}}
+// {{.Name}} follows the resource's link to its {{.Type}}.
+func (t *{{$rt.Name}}) {{.Name}}() *{{.Type}} {
+	return New{{.Type}}(t.client, t.path+"{{.Suffix}}")
+}
+{{end}}
+{{- range .Forms}}
+// {{.Name}} holds the fields of the {{.FormName}} form.
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.FieldType}}{{if .Required}} // required{{end}}
+{{- end}}
+}
+
+// {{.Method}} submits the {{.FormName}} form.
+func (t *{{$rt.Name}}) {{.Method}}(ctx context.Context, form *{{.Name}}) (*hmapi.FormResponse, error) {
+	request := t.client.Resource(t.path).Form("{{.FormName}}")
+{{range .Fields}}
+{{- if .Multiple}}
+	for _, value := range form.{{.Name}} {
+		request.{{.Add}}("{{.FieldName}}", value)
+	}
+{{else if .Nilable}}
+	if form.{{.Name}} != nil {
+		request.{{.Add}}("{{.FieldName}}", {{.Deref}}form.{{.Name}})
+	}
+{{else}}
+	request.{{.Add}}("{{.FieldName}}", form.{{.Name}})
+{{end}}
+{{- end}}
+	return request.Submit(ctx)
+}
+{{end}}
+{{- end}}`))
@@ -0,0 +1,127 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// accessLogEntry is written as one JSON line per request handled by the
+// proxy.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	ClientAddr string    `json:"client_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	Denied     string    `json:"denied,omitempty"`
+}
+
+type accessLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newAccessLogger(w io.Writer) *accessLogger {
+	return &accessLogger{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (t *accessLogger) log(entry *accessLogEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.enc.Encode(entry)
+}
+
+func (t *accessLogger) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{
+			ResponseWriter: rw,
+		}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		clientAddr := r.RemoteAddr
+
+		if clientAddr == "" || clientAddr == "@" {
+			clientAddr = "unix"
+		}
+
+		t.log(&accessLogEntry{
+			Time:       start.UTC(),
+			ClientAddr: clientAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+			Denied:     rec.Header().Get(deniedByHeader),
+		})
+	})
+}
+
+// responseRecorder captures the status and size of a response. It passes
+// through Flush and Hijack so streamed and upgraded responses keep working.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (t *responseRecorder) WriteHeader(status int) {
+	if t.status == 0 {
+		t.status = status
+	}
+
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *responseRecorder) Write(p []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+
+	n, err := t.ResponseWriter.Write(p)
+	t.bytes += int64(n)
+
+	return n, err
+}
+
+func (t *responseRecorder) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := t.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	if t.status == 0 {
+		t.status = http.StatusSwitchingProtocols
+	}
+
+	return hj.Hijack()
+}
+
+func (t *responseRecorder) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
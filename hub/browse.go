@@ -0,0 +1,284 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/deviceio/hmapi"
+)
+
+const browseHelp = `commands:
+  <link>           follow a link. resource links are browsed, others are printed
+  submit <form>    fill in and submit a form
+  cd <path>        browse the resource at an absolute path
+  back             return to the previous resource
+  help             show this help
+  quit             leave the browser
+`
+
+// Browse interactively explores hub resources starting at path, following
+// links and submitting forms described by the resources themselves.
+func Browse(c hmapi.Client, path string) {
+	b := &browser{
+		client:  c,
+		in:      bufio.NewReader(os.Stdin),
+		out:     os.Stdout,
+		history: []string{},
+	}
+
+	b.run(path)
+}
+
+type browser struct {
+	client  hmapi.Client
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+}
+
+func (t *browser) run(path string) {
+	res, err := t.visit(path)
+
+	fmt.Fprint(t.out, browseHelp)
+
+	for {
+		if err != nil {
+			fmt.Fprintf(t.out, "error: %v\n", err)
+		}
+
+		err = nil
+
+		line, ok := t.readLine(fmt.Sprintf("\n%v> ", path))
+
+		if !ok {
+			return
+		}
+
+		cmd, arg := line, ""
+
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch {
+		case cmd == "":
+			if res != nil {
+				describeResource(t.out, path, res)
+			}
+		case cmd == "quit" || cmd == "exit":
+			return
+		case cmd == "help":
+			fmt.Fprint(t.out, browseHelp)
+		case cmd == "back":
+			if len(t.history) == 0 {
+				err = fmt.Errorf("no previous resource")
+				continue
+			}
+
+			path = t.history[len(t.history)-1]
+			t.history = t.history[:len(t.history)-1]
+			res, err = t.visit(path)
+		case cmd == "cd" && arg != "":
+			t.history = append(t.history, path)
+			path = arg
+			res, err = t.visit(path)
+		case cmd == "submit" && arg != "" && res != nil:
+			err = t.submit(path, res, arg)
+		case res != nil && res.Links[line] != nil:
+			link := res.Links[line]
+
+			if link.Type != "" && link.Type != hmapi.MediaTypeHMAPIResource {
+				err = t.fetch(path, line)
+				continue
+			}
+
+			t.history = append(t.history, path)
+			path = link.Href
+			res, err = t.visit(path)
+		default:
+			err = fmt.Errorf("unknown command or link '%v'. type help for commands", line)
+		}
+	}
+}
+
+func (t *browser) visit(path string) (*hmapi.Resource, error) {
+	res, err := t.client.Resource(path).Get(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	describeResource(t.out, path, res)
+
+	return res, nil
+}
+
+// fetch prints the body of a link that is not an hmapi resource.
+func (t *browser) fetch(path, name string) error {
+	resp, err := t.client.Resource(path).Link(name).Get(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return t.printResponse(resp.Response)
+}
+
+func (t *browser) submit(path string, res *hmapi.Resource, name string) error {
+	form, ok := res.Forms[name]
+
+	if !ok {
+		return &hmapi.ErrResourceNoSuchForm{
+			FormName: name,
+			Resource: path,
+		}
+	}
+
+	request := t.client.Resource(path).Form(name)
+	files := []*os.File{}
+
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, field := range form.Fields {
+		given := 0
+
+		for {
+			value, ok := t.promptField(field, given == 0)
+
+			if !ok {
+				return fmt.Errorf("form submission cancelled")
+			}
+
+			if value == "" {
+				break
+			}
+
+			if err := t.addField(request, field, value, &files); err != nil {
+				fmt.Fprintf(t.out, "error: %v\n", err)
+				continue
+			}
+
+			given++
+
+			if !field.Multiple {
+				break
+			}
+		}
+	}
+
+	resp, err := request.Submit(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return t.printResponse(resp.Response)
+}
+
+// promptField reads a value for a form field. Required fields are prompted
+// until answered, and fields accepting multiple values are prompted until an
+// empty line is entered. The default and the required check only apply to
+// the first value of a field.
+func (t *browser) promptField(field *hmapi.FormField, first bool) (string, bool) {
+	label := fmt.Sprintf("%v (%v", field.Name, mediaTypeName(field.Type))
+
+	if field.Required && first {
+		label += ", required"
+	}
+
+	if field.Multiple {
+		label += ", multiple, empty line to finish"
+	}
+
+	if field.Type == hmapi.MediaTypeOctetStream {
+		label += ", path to a file"
+	}
+
+	label += ")"
+
+	defaultValue := ""
+
+	if first {
+		defaultValue = contentValue(field.Value)
+	}
+
+	if defaultValue != "" {
+		label += fmt.Sprintf(" [%v]", defaultValue)
+	}
+
+	for {
+		value, ok := t.readLine(label + ": ")
+
+		if !ok {
+			return "", false
+		}
+
+		if value == "" {
+			value = defaultValue
+		}
+
+		if value == "" && field.Required && first {
+			fmt.Fprintf(t.out, "%v is required\n", field.Name)
+			continue
+		}
+
+		return value, true
+	}
+}
+
+func (t *browser) addField(request hmapi.FormRequest, field *hmapi.FormField, value string, files *[]*os.File) error {
+	if field.Type == hmapi.MediaTypeOctetStream {
+		f, err := os.Open(value)
+
+		if err != nil {
+			return err
+		}
+
+		*files = append(*files, f)
+		request.AddFieldAsOctetStream(field.Name, f)
+
+		return nil
+	}
+
+	return addFormField(request, field.Name, field.Type, value)
+}
+
+func (t *browser) printResponse(resp *http.Response) error {
+	fmt.Fprintf(t.out, "%v\n", resp.Status)
+
+	if _, err := io.Copy(t.out, resp.Body); err != nil {
+		return err
+	}
+
+	if trailer := resp.Trailer.Get("Error"); trailer != "" {
+		return fmt.Errorf("%v", trailer)
+	}
+
+	return nil
+}
+
+func (t *browser) readLine(prompt string) (string, bool) {
+	fmt.Fprint(t.out, prompt)
+
+	line, err := t.in.ReadString('\n')
+
+	if err != nil && line == "" {
+		fmt.Fprintln(t.out)
+		return "", false
+	}
+
+	return strings.TrimSpace(line), true
+}
@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deviceio/hmapi"
+)
+
+// TestBrowseSubmitsMultipleFields checks that a required field accepting
+// multiple values with a default ends at the first empty line after a value
+// was given, rather than applying the default again.
+func TestBrowseSubmitsMultipleFields(t *testing.T) {
+	var submitted []byte
+
+	hub := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			submitted, _ = ioutil.ReadAll(r.Body)
+			return
+		}
+
+		rw.Header().Set("Content-Type", hmapi.MediaTypeHMAPIResource.String())
+		rw.Write([]byte(`{"forms":{"tag":{"action":"/tags","method":"POST","enctype":"application/json","fields":[
+			{"name":"names","type":"application/vnd.hmapi.String","required":true,"multiple":true,"value":"a"}
+		]}}}`))
+	}))
+	defer hub.Close()
+
+	target, _ := url.Parse(hub.URL)
+	port, _ := strconv.Atoi(target.Port())
+
+	c := hmapi.NewClient(&hmapi.ClientConfig{
+		Host: target.Hostname(),
+		Port: port,
+	})
+
+	res, err := c.Resource("/device").Get(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	b := &browser{
+		client:  c,
+		in:      bufio.NewReader(strings.NewReader("\nb\n\n")),
+		out:     out,
+		history: []string{},
+	}
+
+	if err := b.submit("/device", res, "tag"); err != nil {
+		t.Fatalf("%v\n%s", err, out.Bytes())
+	}
+
+	if !bytes.Contains(submitted, []byte(`"a"`)) || !bytes.Contains(submitted, []byte(`"b"`)) {
+		t.Errorf("expected the default and the entered value to be submitted, got %s", submitted)
+	}
+
+	if strings.Count(out.String(), "[a]") != 1 {
+		t.Errorf("expected the default to be offered once, got\n%s", out.Bytes())
+	}
+}
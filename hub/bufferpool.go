@@ -0,0 +1,33 @@
+package hub
+
+import "sync"
+
+const proxyBufferSize = 32 * 1024
+
+var proxyBufferPool = &bufferPool{
+	pool: sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, proxyBufferSize)
+			return &buf
+		},
+	},
+}
+
+// bufferPool recycles the buffers the reverse proxy copies response bodies
+// through, so memory per connection stays flat under many concurrent streams.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func (t *bufferPool) Get() []byte {
+	return *t.pool.Get().(*[]byte)
+}
+
+func (t *bufferPool) Put(buf []byte) {
+	if cap(buf) != proxyBufferSize {
+		return
+	}
+
+	buf = buf[:proxyBufferSize]
+	t.pool.Put(&buf)
+}
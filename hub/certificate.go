@@ -0,0 +1,50 @@
+package hub
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/deviceio/shared/types"
+	"github.com/palantir/stacktrace"
+)
+
+// loadOrCreateCertificate loads the proxy certificate, generating and storing
+// a self-signed one on first use so clients can pin it across restarts.
+func loadOrCreateCertificate(certFile, keyFile, bind string) (tls.Certificate, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		certgen := &types.CertGen{
+			Host:       "localhost,127.0.0.1,::1," + bind,
+			ValidFor:   5 * 8760 * time.Hour,
+			IsCA:       false,
+			EcdsaCurve: "P256",
+		}
+
+		certBytes, keyBytes := certgen.Generate()
+
+		if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+			return tls.Certificate{}, stacktrace.Propagate(err, "failed to create proxy certificate directory")
+		}
+
+		if err := ioutil.WriteFile(keyFile, keyBytes, 0600); err != nil {
+			return tls.Certificate{}, stacktrace.Propagate(err, "failed to write proxy key %v", keyFile)
+		}
+
+		if err := ioutil.WriteFile(certFile, certBytes, 0600); err != nil {
+			return tls.Certificate{}, stacktrace.Propagate(err, "failed to write proxy certificate %v", certFile)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+	if err != nil {
+		return tls.Certificate{}, stacktrace.Propagate(err, "failed to load proxy certificate")
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,27 @@
+package hub
+
+import (
+	"context"
+	"os"
+
+	"github.com/deviceio/cli/output"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+// Content renders a content value of the resource at path. Octet streams are
+// not results and are always written raw.
+func Content(c hmapi.Client, path, name string, out *output.Renderer) error {
+	value, err := c.Resource(path).Content(name).Get(context.Background())
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to get content %v of %v", name, path)
+	}
+
+	if b, ok := value.([]byte); ok {
+		os.Stdout.Write(b)
+		return nil
+	}
+
+	return out.Render(value)
+}
@@ -0,0 +1,135 @@
+package hub
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/output"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+// Graph is the hmapi resource graph reachable from a root resource. It holds
+// the shape of the api, forms, links and content types, but not content
+// values, so graphs taken from different hub and agent versions can be
+// diffed.
+type Graph struct {
+	Root      string           `json:"root"`
+	Resources []*GraphResource `json:"resources"`
+}
+
+// GraphResource is a resource found while crawling.
+type GraphResource struct {
+	Path    string                     `json:"path"`
+	Depth   int                        `json:"depth"`
+	Links   map[string]*hmapi.Link     `json:"links,omitempty"`
+	Forms   map[string]*hmapi.Form     `json:"forms,omitempty"`
+	Content map[string]hmapi.MediaType `json:"content,omitempty"`
+	Error   string                     `json:"error,omitempty"`
+}
+
+// CrawlGraph follows resource links breadth first from root, up to depth
+// links away. Only links to hmapi resources on the hub itself are followed;
+// a resource that cannot be read is recorded with its error.
+func CrawlGraph(c hmapi.Client, root string, depth int) *Graph {
+	graph, _ := crawlGraph(c, root, depth, nil)
+	return graph
+}
+
+// crawlGraph is CrawlGraph calling visit with each resource once it has been
+// read, in the order they are crawled.
+func crawlGraph(c hmapi.Client, root string, depth int, visit func(*GraphResource) error) (*Graph, error) {
+	graph := &Graph{
+		Root:      root,
+		Resources: []*GraphResource{},
+	}
+
+	seen := map[string]bool{root: true}
+	queue := []*GraphResource{{Path: root}}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		graph.Resources = append(graph.Resources, node)
+
+		res, err := c.Resource(node.Path).Get(context.Background())
+
+		if err != nil {
+			node.Error = err.Error()
+		} else {
+			node.Links = res.Links
+			node.Forms = res.Forms
+			node.Content = map[string]hmapi.MediaType{}
+
+			for name, content := range res.Content {
+				node.Content[name] = content.Type
+			}
+		}
+
+		if visit != nil {
+			if err := visit(node); err != nil {
+				return nil, err
+			}
+		}
+
+		if err != nil || node.Depth >= depth {
+			continue
+		}
+
+		for _, name := range sortedLinks(res.Links) {
+			link := res.Links[name]
+
+			if link.Type != hmapi.MediaTypeHMAPIResource || !strings.HasPrefix(link.Href, "/") || seen[link.Href] {
+				continue
+			}
+
+			seen[link.Href] = true
+			queue = append(queue, &GraphResource{
+				Path:  link.Href,
+				Depth: node.Depth + 1,
+			})
+		}
+	}
+
+	sort.Slice(graph.Resources, func(i, j int) bool {
+		return graph.Resources[i].Path < graph.Resources[j].Path
+	})
+
+	return graph, nil
+}
+
+// Crawl renders the resource graph reachable from root, or exports it as dot
+// or markdown. NDJSON output streams every resource as soon as it is read.
+func Crawl(c hmapi.Client, root string, depth int, format string, out *output.Renderer) error {
+	var export func(io.Writer, *Graph) error
+
+	switch format {
+	case "json":
+		if out.Format() != output.NDJSON {
+			return out.Text(writeGraphTable).Render(CrawlGraph(c, root, depth))
+		}
+
+		if _, err := crawlGraph(c, root, depth, func(node *GraphResource) error { return out.Add(node) }); err != nil {
+			return err
+		}
+
+		return out.Flush()
+	case "dot":
+		export = exportGraphDOT
+	case "markdown":
+		export = exportGraphMarkdown
+	default:
+		return stacktrace.NewErrorWithCode(exitcode.Usage, "unknown graph format '%v'", format)
+	}
+
+	if err := export(os.Stdout, CrawlGraph(c, root, depth)); err != nil {
+		return stacktrace.Propagate(err, "failed to export resource graph")
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package hub
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/deviceio/hmapi"
+)
+
+// writeGraphTable lists the crawled resources of a graph, the table layout
+// of hub crawl.
+func writeGraphTable(w io.Writer, value interface{}) error {
+	graph := value.(*Graph)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "PATH\tDEPTH\tLINKS\tFORMS\tERROR")
+
+	for _, res := range graph.Resources {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", res.Path, res.Depth, len(res.Links), strings.Join(sortedForms(res.Forms), ","), res.Error)
+	}
+
+	return tw.Flush()
+}
+
+// exportGraphDOT writes a Graphviz digraph with a record per resource
+// listing its forms, and an edge per followed link.
+func exportGraphDOT(w io.Writer, graph *Graph) error {
+	crawled := map[string]bool{}
+
+	for _, node := range graph.Resources {
+		crawled[node.Path] = true
+	}
+
+	fmt.Fprintln(w, "digraph hmapi {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=record];")
+
+	for _, node := range graph.Resources {
+		label := []string{dotEscape(node.Path)}
+
+		for _, name := range sortedForms(node.Forms) {
+			form := node.Forms[name]
+			label = append(label, dotEscape(fmt.Sprintf("%v %v(%v)", form.Method, name, formFieldNames(form.Fields))))
+		}
+
+		if node.Error != "" {
+			label = append(label, dotEscape("error: "+node.Error))
+		}
+
+		fmt.Fprintf(w, "  %v [label=\"{%v}\"];\n", strconv.Quote(node.Path), strings.Join(label, "|"))
+	}
+
+	for _, node := range graph.Resources {
+		for _, name := range sortedLinks(node.Links) {
+			link := node.Links[name]
+
+			if !crawled[link.Href] {
+				continue
+			}
+
+			fmt.Fprintf(w, "  %v -> %v [label=%v];\n", strconv.Quote(node.Path), strconv.Quote(link.Href), strconv.Quote(name))
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+
+	return err
+}
+
+func exportGraphMarkdown(w io.Writer, graph *Graph) error {
+	fmt.Fprintf(w, "# hmapi resources from `%v`\n", graph.Root)
+
+	for _, node := range graph.Resources {
+		fmt.Fprintf(w, "\n## `%v`\n", node.Path)
+
+		if node.Error != "" {
+			fmt.Fprintf(w, "\nError: %v\n", node.Error)
+			continue
+		}
+
+		if len(node.Links) > 0 {
+			fmt.Fprintln(w, "\n| Link | Href | Type |")
+			fmt.Fprintln(w, "|------|------|------|")
+
+			for _, name := range sortedLinks(node.Links) {
+				link := node.Links[name]
+				fmt.Fprintf(w, "| %v | `%v` | %v |\n", name, link.Href, mediaTypeName(link.Type))
+			}
+		}
+
+		if len(node.Content) > 0 {
+			fmt.Fprintln(w, "\n| Content | Type |")
+			fmt.Fprintln(w, "|---------|------|")
+
+			names := []string{}
+
+			for name := range node.Content {
+				names = append(names, name)
+			}
+
+			sort.Strings(names)
+
+			for _, name := range names {
+				fmt.Fprintf(w, "| %v | %v |\n", name, mediaTypeName(node.Content[name]))
+			}
+		}
+
+		for _, name := range sortedForms(node.Forms) {
+			form := node.Forms[name]
+
+			fmt.Fprintf(w, "\n### Form `%v`\n\n`%v %v` (%v)\n", name, form.Method, form.Action, mediaTypeName(form.Enctype))
+
+			if len(form.Fields) == 0 {
+				continue
+			}
+
+			fmt.Fprintln(w, "\n| Field | Type | Required | Multiple |")
+			fmt.Fprintln(w, "|-------|------|----------|----------|")
+
+			for _, field := range form.Fields {
+				fmt.Fprintf(w, "| %v | %v | %v | %v |\n", field.Name, mediaTypeName(field.Type), field.Required, field.Multiple)
+			}
+		}
+	}
+
+	return nil
+}
+
+func formFieldNames(fields []*hmapi.FormField) string {
+	names := []string{}
+
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// dotEscape escapes text for use inside a record label.
+func dotEscape(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		`{`, `\{`,
+		`}`, `\}`,
+		`|`, `\|`,
+		`<`, `\<`,
+		`>`, `\>`,
+	)
+
+	return replacer.Replace(s)
+}
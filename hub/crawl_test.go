@@ -0,0 +1,195 @@
+package hub
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/deviceio/hmapi"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// crawlResources is an hmapi fixture whose device links back to the device
+// list, forming a cycle. Links to content that is not a resource and to
+// other hosts must not be followed, and /device/d1/gone cannot be read.
+var crawlResources = map[string]string{
+	"/device": `{
+		"links": {
+			"d1": {"href": "/device/d1", "type": "application/vnd.hmapi.Resource+json"},
+			"docs": {"href": "https://docs.example.com/device", "type": "application/vnd.hmapi.Resource+json"},
+			"readme": {"href": "/device/readme", "type": "text/plain"}
+		}
+	}`,
+	"/device/d1": `{
+		"links": {
+			"devices": {"href": "/device", "type": "application/vnd.hmapi.Resource+json"},
+			"gone": {"href": "/device/d1/gone", "type": "application/vnd.hmapi.Resource+json"},
+			"process": {"href": "/device/d1/process", "type": "application/vnd.hmapi.Resource+json"},
+			"self": {"href": "/device/d1", "type": "application/vnd.hmapi.Resource+json"}
+		},
+		"content": {
+			"hostname": {"type": "application/vnd.hmapi.String", "value": "web-1"}
+		}
+	}`,
+	"/device/d1/process": `{
+		"links": {
+			"p1": {"href": "/device/d1/process/p1", "type": "application/vnd.hmapi.Resource+json"}
+		},
+		"forms": {
+			"create": {"action": "/device/d1/process", "method": "POST", "enctype": "application/json", "fields": [
+				{"name": "cmd", "type": "application/vnd.hmapi.String", "required": true},
+				{"name": "arg", "type": "application/vnd.hmapi.String", "multiple": true}
+			]}
+		}
+	}`,
+	"/device/d1/process/p1": `{
+		"links": {
+			"process": {"href": "/device/d1/process", "type": "application/vnd.hmapi.Resource+json"}
+		}
+	}`,
+}
+
+// crawlHub serves crawlResources and counts the requests for each path.
+func crawlHub() (hmapi.Client, map[string]int, func()) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+
+	hub := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		resource, ok := crawlResources[r.URL.Path]
+
+		if !ok {
+			http.NotFound(rw, r)
+			return
+		}
+
+		rw.Header().Set("Content-Type", hmapi.MediaTypeHMAPIResource.String())
+		rw.Write([]byte(resource))
+	}))
+
+	target, _ := url.Parse(hub.URL)
+	port, _ := strconv.Atoi(target.Port())
+
+	return hmapi.NewClient(&hmapi.ClientConfig{
+		Host: target.Hostname(),
+		Port: port,
+	}), requests, hub.Close
+}
+
+func crawledPaths(graph *Graph) map[string]int {
+	paths := map[string]int{}
+
+	for _, res := range graph.Resources {
+		paths[res.Path] = res.Depth
+	}
+
+	return paths
+}
+
+// TestCrawlGraphVisitsEachResourceOnce checks that cycles and self links do
+// not lead the crawl back to resources it has read, and that only resource
+// links on the hub are followed.
+func TestCrawlGraphVisitsEachResourceOnce(t *testing.T) {
+	c, requests, done := crawlHub()
+	defer done()
+
+	graph := CrawlGraph(c, "/device", 10)
+
+	expected := map[string]int{
+		"/device":               0,
+		"/device/d1":            1,
+		"/device/d1/gone":       2,
+		"/device/d1/process":    2,
+		"/device/d1/process/p1": 3,
+	}
+
+	if paths := crawledPaths(graph); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected resources %v, got %v", expected, paths)
+	}
+
+	for path, count := range requests {
+		if count != 1 {
+			t.Errorf("%v: expected one request, got %v", path, count)
+		}
+	}
+
+	for _, res := range graph.Resources {
+		if (res.Error != "") != (res.Path == "/device/d1/gone") {
+			t.Errorf("%v: unexpected error %q", res.Path, res.Error)
+		}
+	}
+}
+
+func TestCrawlGraphStopsAtDepth(t *testing.T) {
+	c, requests, done := crawlHub()
+	defer done()
+
+	graph := CrawlGraph(c, "/device", 1)
+
+	expected := map[string]int{
+		"/device":    0,
+		"/device/d1": 1,
+	}
+
+	if paths := crawledPaths(graph); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected resources %v, got %v", expected, paths)
+	}
+
+	if requests["/device/d1/process"] != 0 {
+		t.Errorf("expected resources beyond the depth not to be read")
+	}
+}
+
+// TestExportGraph exports the crawled fixture in every format, comparing the
+// output with testdata/crawl.<format>.golden.
+func TestExportGraph(t *testing.T) {
+	c, _, done := crawlHub()
+	defer done()
+
+	graph := CrawlGraph(c, "/device", 10)
+
+	for format, export := range map[string]func(io.Writer, *Graph) error{
+		"dot":      exportGraphDOT,
+		"markdown": exportGraphMarkdown,
+		"table": func(w io.Writer, graph *Graph) error {
+			return writeGraphTable(w, graph)
+		},
+	} {
+		out := &bytes.Buffer{}
+
+		if err := export(out, graph); err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+
+		golden := filepath.Join("testdata", "crawl."+format+".golden")
+
+		if *update {
+			if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(out.Bytes(), expected) {
+			t.Errorf("%v: output differs from %v\n%s", format, golden, out.Bytes())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package hub
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/tlsconfig"
+	sdk "github.com/deviceio/sdk/go-sdk"
+	"github.com/palantir/stacktrace"
+)
+
+// CurlRequest is an arbitrary request to the hub api, described with curl's
+// options.
+type CurlRequest struct {
+	HubHost string
+	HubPort int
+	TLS     *tlsconfig.Config
+	Auth    *sdk.ClientAuth
+
+	// Transport sends the request. Defaults to a transport of its own
+	// configured with TLS.
+	Transport http.RoundTripper
+
+	Method  string
+	Path    string
+	Headers []string
+
+	// Data is sent as the request body. '@file' reads the body from a file
+	// and '@-' from stdin, as with curl's --data-binary.
+	Data string
+
+	// Include prints the response status line and headers before the body.
+	Include bool
+
+	// PrintHeaders prints the signed request headers to stderr.
+	PrintHeaders bool
+
+	// EmitCurl prints a curl command carrying the signature instead of
+	// sending the request. The signature is valid for the current TOTP
+	// window only.
+	EmitCurl bool
+}
+
+// Curl signs the request with the profile's credentials and prints the
+// response, or emits an equivalent curl command.
+func Curl(config *CurlRequest) error {
+	request, err := config.request()
+
+	if err != nil {
+		return stacktrace.PropagateWithCode(err, exitcode.Usage, "")
+	}
+
+	config.Auth.Sign(request)
+
+	if config.EmitCurl {
+		fmt.Println(config.curlCommand(request))
+		return nil
+	}
+
+	if config.PrintHeaders {
+		fmt.Fprintf(os.Stderr, "%v %v %v\r\n", request.Method, request.URL.RequestURI(), request.Proto)
+		fmt.Fprintf(os.Stderr, "Host: %v\r\n", request.Host)
+		request.Header.Write(os.Stderr)
+		fmt.Fprint(os.Stderr, "\r\n")
+	}
+
+	if config.Transport == nil {
+		tlsConfig, err := config.TLS.TLSConfig()
+
+		if err != nil {
+			return stacktrace.Propagate(err, "failed to configure hub tls")
+		}
+
+		config.Transport = &http.Transport{
+			TLSClientConfig: tlsConfig,
+		}
+	}
+
+	client := &http.Client{
+		Transport: config.Transport,
+	}
+
+	resp, err := client.Do(request)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to send %v %v", request.Method, request.URL.Path)
+	}
+
+	return writeResponse(resp, config.Include)
+}
+
+func (t *CurlRequest) request() (*http.Request, error) {
+	var body io.Reader
+
+	switch {
+	case t.Data == "@-" && !t.EmitCurl:
+		body = os.Stdin
+	case strings.HasPrefix(t.Data, "@") && !t.EmitCurl:
+		content, err := ioutil.ReadFile(t.Data[1:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = bytes.NewReader(content)
+	case t.Data != "" && !t.EmitCurl:
+		body = strings.NewReader(t.Data)
+	}
+
+	method := t.Method
+
+	if method == "" {
+		method = http.MethodGet
+
+		if t.Data != "" {
+			method = http.MethodPost
+		}
+	}
+
+	url := fmt.Sprintf(
+		"https://%v/%v",
+		net.JoinHostPort(t.HubHost, strconv.Itoa(t.HubPort)),
+		strings.TrimPrefix(t.Path, "/"),
+	)
+
+	request, err := http.NewRequest(strings.ToUpper(method), url, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, header := range t.Headers {
+		parts := strings.SplitN(header, ":", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected 'Name: value' header, got '%v'", header)
+		}
+
+		request.Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	// The content type is part of the signature, so curl's implicit
+	// urlencoded type for data is made explicit on both paths.
+	if t.Data != "" && request.Header.Get("Content-Type") == "" {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return request, nil
+}
+
+func (t *CurlRequest) curlCommand(request *http.Request) string {
+	args := []string{"curl", "-sS"}
+	args = append(args, t.TLS.CurlArgs()...)
+
+	if t.Include {
+		args = append(args, "-i")
+	}
+
+	args = append(args, "-X", request.Method)
+
+	// The Host header is signed, and curl leaves the port out of it for
+	// 443, so the signed value is sent explicitly.
+	args = append(args, "-H", "Host: "+request.Host)
+
+	for _, name := range sortedHeaderNames(request.Header) {
+		for _, value := range request.Header[name] {
+			args = append(args, "-H", name+": "+value)
+		}
+	}
+
+	if t.Data != "" {
+		args = append(args, "--data-binary", t.Data)
+	}
+
+	args = append(args, request.URL.String())
+
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+
+	return strings.Join(args, " ")
+}
+
+func sortedHeaderNames(header http.Header) []string {
+	names := []string{}
+
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// shellQuote quotes an argument for POSIX shells unless it is made only of
+// characters that need no quoting.
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+", r))
+	}) < 0 {
+		return arg
+	}
+
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
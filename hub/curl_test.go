@@ -0,0 +1,45 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deviceio/cli/auth"
+	"github.com/deviceio/cli/tlsconfig"
+	sdk "github.com/deviceio/sdk/go-sdk"
+)
+
+func TestCurlCommandSendsSignedHost(t *testing.T) {
+	creds, err := auth.GenerateCredentials("test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &CurlRequest{
+		HubHost: "hub.example.com",
+		HubPort: 443,
+		TLS:     &tlsconfig.Config{},
+		Auth: &sdk.ClientAuth{
+			UserID:         creds.UserID,
+			UserTOTPSecret: creds.TOTPSecret,
+			UserPrivateKey: creds.PrivateKey,
+		},
+		Path:     "/device",
+		EmitCurl: true,
+	}
+
+	request, err := config.request()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Auth.Sign(request)
+
+	command := config.curlCommand(request)
+
+	if !strings.Contains(command, "-H 'Host: hub.example.com:443'") {
+		t.Errorf("expected the signed host to be sent, got %v", command)
+	}
+}
@@ -0,0 +1,163 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/deviceio/cli/output"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+// Description is a resource as rendered by hub describe.
+type Description struct {
+	Path string `json:"path"`
+	*hmapi.Resource
+}
+
+// Describe renders the links, forms and content of the hub resource at path.
+// Table output lists them in sections.
+func Describe(c hmapi.Client, path string, out *output.Renderer) error {
+	res, err := c.Resource(path).Get(context.Background())
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to get %v", path)
+	}
+
+	return out.Text(func(w io.Writer, value interface{}) error {
+		description := value.(*Description)
+		describeResource(w, description.Path, description.Resource)
+		return nil
+	}).Render(&Description{Path: path, Resource: res})
+}
+
+func describeResource(out io.Writer, path string, res *hmapi.Resource) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(w, "RESOURCE %v\n", path)
+
+	if len(res.Links) > 0 {
+		fmt.Fprintln(w, "\nLINKS")
+		fmt.Fprintln(w, "  NAME\tHREF\tTYPE")
+
+		for _, name := range sortedLinks(res.Links) {
+			link := res.Links[name]
+			fmt.Fprintf(w, "  %v\t%v\t%v\n", name, link.Href, mediaTypeName(link.Type))
+		}
+	}
+
+	for _, name := range sortedForms(res.Forms) {
+		form := res.Forms[name]
+
+		fmt.Fprintf(w, "\nFORM %v\t%v %v\n", name, form.Method, form.Action)
+
+		if form.Enctype != "" {
+			fmt.Fprintf(w, "  enctype\t%v\n", mediaTypeName(form.Enctype))
+		}
+
+		if form.Type != "" {
+			fmt.Fprintf(w, "  returns\t%v\n", mediaTypeName(form.Type))
+		}
+
+		if len(form.Fields) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(w, "  FIELD\tTYPE\tREQUIRED\tMULTIPLE\tDEFAULT")
+
+		for _, field := range form.Fields {
+			fmt.Fprintf(
+				w,
+				"  %v\t%v\t%v\t%v\t%v\n",
+				field.Name,
+				mediaTypeName(field.Type),
+				field.Required,
+				field.Multiple,
+				contentValue(field.Value),
+			)
+		}
+	}
+
+	if len(res.Content) > 0 {
+		fmt.Fprintln(w, "\nCONTENT")
+		fmt.Fprintln(w, "  NAME\tTYPE\tVALUE")
+
+		names := []string{}
+
+		for name := range res.Content {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			content := res.Content[name]
+			fmt.Fprintf(w, "  %v\t%v\t%v\n", name, mediaTypeName(content.Type), contentValue(content.Value))
+		}
+	}
+
+	w.Flush()
+}
+
+// mediaTypeName shortens hmapi's vendor media types to their type name, so
+// application/vnd.hmapi.String prints as String.
+func mediaTypeName(media hmapi.MediaType) string {
+	switch {
+	case media == "":
+		return "-"
+	case media == hmapi.MediaTypeHMAPIResource:
+		return "Resource"
+	case media == hmapi.MediaTypeMultipartFormData:
+		return "multipart/form-data"
+	case strings.HasPrefix(media.String(), "application/vnd.hmapi."):
+		return strings.TrimPrefix(media.String(), "application/vnd.hmapi.")
+	default:
+		return media.String()
+	}
+}
+
+func contentValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		jsonb, err := json.Marshal(v)
+
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+
+		return string(jsonb)
+	}
+}
+
+func sortedLinks(links map[string]*hmapi.Link) []string {
+	names := []string{}
+
+	for name := range links {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func sortedForms(forms map[string]*hmapi.Form) []string {
+	names := []string{}
+
+	for name := range forms {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
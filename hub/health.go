@@ -0,0 +1,120 @@
+package hub
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// upstreamHealth records the outcome of the latest health check of a hub.
+type upstreamHealth struct {
+	mu      sync.RWMutex
+	checked time.Time
+	healthy bool
+	status  int
+	latency time.Duration
+	err     string
+}
+
+type upstreamHealthSnapshot struct {
+	Checked time.Time
+	Healthy bool
+	Status  int
+	Latency time.Duration
+	Error   string
+}
+
+func (t *upstreamHealth) snapshot() upstreamHealthSnapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return upstreamHealthSnapshot{
+		Checked: t.checked,
+		Healthy: t.healthy,
+		Status:  t.status,
+		Latency: t.latency,
+		Error:   t.err,
+	}
+}
+
+// checkHealth checks every hub immediately and then once per interval until
+// done is closed.
+func (t *proxyRouter) checkHealth(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+
+		for _, route := range t.routes {
+			wg.Add(1)
+			go func(route *proxyRoute) {
+				defer wg.Done()
+				route.check(interval)
+			}(route)
+		}
+
+		wg.Wait()
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check sends a signed request for the hub's root resource. Any response
+// below 500 counts as healthy: the hub is reachable and accepted the
+// connection, even if it rejects the profile's credentials.
+func (t *proxyRoute) check(timeout time.Duration) {
+	client := &http.Client{
+		Transport: t.transport,
+		Timeout:   timeout,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, t.upstream.url().String(), nil)
+
+	if err != nil {
+		t.health.update(0, 0, err)
+		return
+	}
+
+	t.upstream.Auth.Sign(req)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+
+	if err != nil {
+		t.health.update(0, latency, err)
+	} else {
+		resp.Body.Close()
+		t.health.update(resp.StatusCode, latency, nil)
+	}
+
+	if health := t.health.snapshot(); !health.Healthy {
+		logrus.WithFields(logrus.Fields{
+			"hub":    t.upstream.Name,
+			"status": health.Status,
+			"error":  health.Error,
+		}).Warn("Hub health check failed")
+	}
+}
+
+func (t *upstreamHealth) update(status int, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.checked = time.Now()
+	t.status = status
+	t.latency = latency
+	t.healthy = err == nil && status < http.StatusInternalServerError
+	t.err = ""
+
+	if err != nil {
+		t.err = err.Error()
+	}
+}
@@ -0,0 +1,171 @@
+package hub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	policyAllow = "allow"
+	policyDeny  = "deny"
+
+	// deniedByHeader tells the access log which rule denied a request.
+	deniedByHeader = "X-Deviceio-Proxy-Denied-By"
+)
+
+// ProxyPolicy decides which requests a proxy forwards to the hub. Rules are
+// evaluated in order and the first rule matching both the method and the path
+// decides; requests matching no rule get the Default action.
+//
+// Path patterns use path.Match syntax per segment, so '*' matches within a
+// single segment. A '**' segment matches any number of segments.
+type ProxyPolicy struct {
+	Default string       `yaml:"default"`
+	Rules   []*ProxyRule `yaml:"rules"`
+}
+
+type ProxyRule struct {
+	Action  string   `yaml:"action"`
+	Methods []string `yaml:"methods"`
+	Paths   []string `yaml:"paths"`
+}
+
+// LoadProxyPolicy reads a policy from a YAML or JSON file.
+func LoadProxyPolicy(file string) (*ProxyPolicy, error) {
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to read proxy policy %v", file)
+	}
+
+	policy := &ProxyPolicy{}
+
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, stacktrace.Propagate(err, "failed to parse proxy policy %v", file)
+	}
+
+	if policy.Default == "" {
+		policy.Default = policyDeny
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, stacktrace.Propagate(err, "invalid proxy policy %v", file)
+	}
+
+	return policy, nil
+}
+
+func (t *ProxyPolicy) validate() error {
+	if t.Default != policyAllow && t.Default != policyDeny {
+		return fmt.Errorf("default must be '%v' or '%v'", policyAllow, policyDeny)
+	}
+
+	for i, rule := range t.Rules {
+		if rule.Action != policyAllow && rule.Action != policyDeny {
+			return fmt.Errorf("rule %v: action must be '%v' or '%v'", i+1, policyAllow, policyDeny)
+		}
+
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %v: invalid path pattern '%v'", i+1, pattern)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Decide returns the action for a request and a description of the deciding
+// rule.
+func (t *ProxyPolicy) Decide(method, urlpath string) (string, string) {
+	for i, rule := range t.Rules {
+		if rule.matches(method, urlpath) {
+			return rule.Action, fmt.Sprintf("rule %v", i+1)
+		}
+	}
+
+	return t.Default, "default"
+}
+
+func (t *ProxyPolicy) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		action, by := t.Decide(r.Method, r.URL.Path)
+
+		if action != policyAllow {
+			rw.Header().Set(deniedByHeader, by)
+			http.Error(rw, fmt.Sprintf("%v %v denied by proxy policy (%v)", r.Method, r.URL.Path, by), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (t *ProxyRule) matches(method, urlpath string) bool {
+	if len(t.Methods) > 0 {
+		found := false
+
+		for _, m := range t.Methods {
+			if strings.EqualFold(m, method) || m == "*" {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(t.Paths) == 0 {
+		return true
+	}
+
+	for _, pattern := range t.Paths {
+		if matchPath(pattern, urlpath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPath(pattern, urlpath string) bool {
+	return matchSegments(
+		strings.Split(strings.Trim(pattern, "/"), "/"),
+		strings.Split(strings.Trim(path.Clean("/"+urlpath), "/"), "/"),
+	)
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+
+	return len(segments) == 0
+}
@@ -1,105 +1,230 @@
 package hub
 
 import (
-	"bytes"
+	"crypto/subtle"
 	"crypto/tls"
-	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/deviceio/cli/exitcode"
 	sdk "github.com/deviceio/sdk/go-sdk"
-	"github.com/deviceio/shared/types"
+	"github.com/palantir/stacktrace"
 )
 
-type bufpool struct {
-	size int64
+// ProxyConfig configures a local hub api proxy.
+type ProxyConfig struct {
+	HubHost string
+	HubPort int
+	HubTLS  *tls.Config
+	Auth    *sdk.ClientAuth
+
+	// Transport carries requests to the default hub. Defaults to a
+	// transport of its own configured with HubTLS.
+	Transport *http.Transport
+
+	// Bind is the local address to listen on for tcp connections. Defaults
+	// to 127.0.0.1 so the signed connection is not shared with the network.
+	Bind string
+	Port int
+
+	// UnixSocket listens on a unix socket restricted to the current user
+	// instead of a tcp port. Connections on the socket are plain http.
+	UnixSocket string
+
+	// CertFile and KeyFile hold the proxy's tls certificate. A self-signed
+	// certificate is generated into them when neither file exists.
+	CertFile string
+	KeyFile  string
+
+	// Token, when set, must be presented by local clients as a bearer token
+	// in the Authorization header.
+	Token string
+
+	// AccessLog receives a JSON line for every request, including requests
+	// rejected by the token check or the policy.
+	AccessLog io.Writer
+
+	// Policy restricts which methods and paths are forwarded to the hubs.
+	// Paths are matched as the hub receives them, without a route's path
+	// prefix.
+	Policy *ProxyPolicy
+
+	// Upstreams are further hubs routed by path prefix or Host header.
+	// Requests matching none of them go to the default hub configured above.
+	Upstreams []*ProxyUpstream
+
+	// HealthInterval is how often each hub is health checked. Defaults to
+	// 30 seconds.
+	HealthInterval time.Duration
 }
 
-func (t *bufpool) Get() []byte {
-	return make([]byte, t.size)
-}
-
-func (t *bufpool) Put([]byte) {
-}
+func Proxy(config *ProxyConfig) error {
+	if config.Bind == "" {
+		config.Bind = "127.0.0.1"
+	}
 
-func Proxy(hubHost string, hubPort int, localPort int, c *sdk.ClientAuth) {
-	certpath, keypath := makeTempCertificates()
+	if config.HealthInterval == 0 {
+		config.HealthInterval = 30 * time.Second
+	}
 
-	rpurl, err := url.Parse(fmt.Sprintf("https://%v:%v/", hubHost, hubPort))
+	router, err := newProxyRouter(config)
 
 	if err != nil {
-		logrus.WithField("error", err.Error()).Fatal("Error parsing reverse proxy url")
+		return stacktrace.PropagateWithCode(err, exitcode.Usage, "failed to configure hub routes")
 	}
 
-	rp := types.NewSingleHostReverseProxy(rpurl)
-	rpdir := rp.Director
-	rp.Director = func(r *http.Request) {
-		rpdir(r)
-		c.Sign(r)
+	server := &http.Server{
+		Handler: newProxyHandler(config, router),
 	}
 
-	rp.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+	listener, err := proxyListener(config, server)
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to start local hub api proxy")
 	}
 
-	rp.BufferPool = &bufpool{
-		size: 250000,
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go router.checkHealth(config.HealthInterval, done)
+
+	go func() {
+		<-sigch
+		server.Close()
+	}()
+
+	for _, route := range router.routes {
+		logrus.WithFields(logrus.Fields{
+			"name":  route.upstream.Name,
+			"route": route.upstream.route(),
+			"hub":   route.upstream.url().Host,
+		}).Info("Routing to hub")
 	}
 
-	http.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
-		rp.ServeHTTP(rw, r)
-	})
+	listen := listener.Addr().String()
+
+	if config.UnixSocket != "" {
+		listen = config.UnixSocket
+	}
 
 	logrus.WithFields(logrus.Fields{
-		"port":     localPort,
-		"tempcert": certpath,
-		"tempkey":  keypath,
+		"listen": listen,
+		"token":  config.Token != "",
+		"policy": config.Policy != nil,
 	}).Info("Starting local hub api proxy")
 
-	err = http.ListenAndServeTLS(fmt.Sprintf(":%v", localPort), certpath, keypath, nil)
+	err = server.Serve(listener)
+
+	if config.UnixSocket != "" {
+		os.Remove(config.UnixSocket)
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		return stacktrace.Propagate(err, "local hub api proxy failed")
+	}
+
+	return nil
+}
+
+func newProxyHandler(config *ProxyConfig, router *proxyRouter) http.Handler {
+	handler := router.statusHandler(router)
+
+	if config.Token != "" {
+		handler = requireToken(config.Token, handler)
+	}
+
+	if config.AccessLog != nil {
+		handler = newAccessLogger(config.AccessLog).handler(handler)
+	}
+
+	return handler
+}
+
+func proxyListener(config *ProxyConfig, server *http.Server) (net.Listener, error) {
+	if config.UnixSocket != "" {
+		return listenUnix(config.UnixSocket)
+	}
+
+	cert, err := loadOrCreateCertificate(config.CertFile, config.KeyFile, config.Bind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(config.Bind, strconv.Itoa(config.Port)))
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+
+	return tls.NewListener(listener, server.TLSConfig), nil
 }
 
-func makeTempCertificates() (string, string) {
-	certgen := &types.CertGen{
-		Host:      "localhost",
-		ValidFrom: "Jan 1 15:04:05 2011",
-		ValidFor:  8760 * time.Hour,
-		IsCA:      false,
-		RsaBits:   4096,
+// listenUnix binds the socket inside a private directory and only moves it to
+// path once its mode is 0600, so no other user can connect in between.
+func listenUnix(path string) (net.Listener, error) {
+	os.Remove(path)
+
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".")
+
+	if err != nil {
+		return nil, err
 	}
 
-	var err error
-	var certBytes []byte
-	var certTemp *os.File
-	var keyBytes []byte
-	var keyTemp *os.File
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "s")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+
+	if err != nil {
+		return nil, err
+	}
 
-	certBytes, keyBytes = certgen.Generate()
+	// The socket is removed from path by Proxy once it is done serving.
+	listener.SetUnlinkOnClose(false)
 
-	if certTemp, err = ioutil.TempFile("", "deviceio-cli"); err != nil {
-		logrus.Fatal(err.Error())
+	if err := os.Chmod(private, 0600); err != nil {
+		listener.Close()
+		return nil, err
 	}
-	defer certTemp.Close()
 
-	if keyTemp, err = ioutil.TempFile("", "deviceio-cli"); err != nil {
-		logrus.Fatal(err.Error())
+	if err := os.Rename(private, path); err != nil {
+		listener.Close()
+		return nil, err
 	}
-	defer keyTemp.Close()
 
-	io.Copy(certTemp, bytes.NewBuffer(certBytes))
-	io.Copy(keyTemp, bytes.NewBuffer(keyBytes))
+	return listener, nil
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
 
-	return certTemp.Name(), keyTemp.Name()
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		actual := []byte(strings.TrimSpace(r.Header.Get("Authorization")))
+
+		if subtle.ConstantTimeCompare(actual, expected) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="deviceio hub proxy"`)
+			http.Error(rw, "missing or invalid proxy token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
 }
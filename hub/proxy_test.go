@@ -0,0 +1,290 @@
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deviceio/cli/auth"
+	sdk "github.com/deviceio/sdk/go-sdk"
+)
+
+// newTestUpstream starts a tls hub serving handler and returns an upstream
+// signing requests for the given user.
+func newTestUpstream(t testing.TB, userid string, handler http.Handler) (*ProxyUpstream, func()) {
+	hub := httptest.NewTLSServer(handler)
+
+	creds, err := auth.GenerateCredentials(userid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, _ := url.Parse(hub.URL)
+	port, _ := strconv.Atoi(target.Port())
+
+	return &ProxyUpstream{
+		Name:    userid,
+		HubHost: target.Hostname(),
+		HubPort: port,
+		HubTLS: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+		Auth: &sdk.ClientAuth{
+			UserID:         creds.UserID,
+			UserTOTPSecret: creds.TOTPSecret,
+			UserPrivateKey: creds.PrivateKey,
+		},
+	}, hub.Close
+}
+
+func newTestProxyServer(t testing.TB, config *ProxyConfig) *httptest.Server {
+	router, err := newProxyRouter(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(newProxyHandler(config, router))
+}
+
+func newTestProxy(t testing.TB, handler http.Handler) (*httptest.Server, func()) {
+	upstream, closeHub := newTestUpstream(t, "test", handler)
+
+	proxy := newTestProxyServer(t, &ProxyConfig{
+		HubHost: upstream.HubHost,
+		HubPort: upstream.HubPort,
+		HubTLS:  upstream.HubTLS,
+		Auth:    upstream.Auth,
+	})
+
+	return proxy, func() {
+		proxy.Close()
+		closeHub()
+	}
+}
+
+func TestProxySignsRequestsAndPassesTrailers(t *testing.T) {
+	proxy, done := newTestProxy(t, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "DEVICEIO-HUB-AUTH test:") {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rw.Header().Set("Trailer", "Error")
+		rw.Write([]byte("partial"))
+		rw.Header().Set("Error", "read failed")
+	}))
+	defer done()
+
+	resp, err := http.Get(proxy.URL + "/device/x/filesystem")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "partial" {
+		t.Fatalf("unexpected response %v %q", resp.StatusCode, body)
+	}
+
+	if actual := resp.Trailer.Get("Error"); actual != "read failed" {
+		t.Fatalf("expected Error trailer 'read failed', got %q", actual)
+	}
+}
+
+func TestProxyFlushesStreamedResponses(t *testing.T) {
+	release := make(chan struct{})
+
+	proxy, done := newTestProxy(t, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("first"))
+		rw.(http.Flusher).Flush()
+		<-release
+		rw.Write([]byte("second"))
+	}))
+	defer done()
+	defer close(release)
+
+	resp, err := http.Get(proxy.URL + "/process/1/stdout")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, 5)
+	read := make(chan error, 1)
+
+	go func() {
+		_, err := io.ReadFull(resp.Body, buf)
+		read <- err
+	}()
+
+	select {
+	case err := <-read:
+		if err != nil || string(buf) != "first" {
+			t.Fatalf("unexpected read %q %v", buf, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first chunk was not flushed before the stream completed")
+	}
+}
+
+func TestProxyTunnelsUpgrades(t *testing.T) {
+	proxy, done := newTestProxy(t, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, brw, err := rw.(http.Hijacker).Hijack()
+
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+
+		line, _ := brw.ReadString('\n')
+		brw.WriteString("echo " + line)
+		brw.Flush()
+	}))
+	defer done()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(proxy.URL, "http://"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET /process/1/stream HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %v", resp.StatusCode)
+	}
+
+	fmt.Fprintf(conn, "hello\n")
+
+	line, err := reader.ReadString('\n')
+
+	if err != nil || line != "echo hello\n" {
+		t.Fatalf("unexpected tunnelled reply %q %v", line, err)
+	}
+}
+
+func TestProxyUnixSocketIsPrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hub.sock")
+	listener, err := listenUnix(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected a socket with mode 0600, got %v", info.Mode())
+	}
+
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected only the socket in %v, got %v entries", dir, len(entries))
+	}
+
+	conn, err := net.Dial("unix", path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Close()
+}
+
+func BenchmarkProxyThroughput(b *testing.B) {
+	payload := bytes.Repeat([]byte("x"), 4*1024*1024)
+
+	proxy, done := newTestProxy(b, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write(payload)
+	}))
+	defer done()
+
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		resp, err := http.Get(proxy.URL + "/device/x/filesystem")
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// BenchmarkProxyConnections reports the allocations made per proxied
+// request across many concurrent connections.
+func BenchmarkProxyConnections(b *testing.B) {
+	payload := bytes.Repeat([]byte("x"), 64*1024)
+
+	proxy, done := newTestProxy(b, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write(payload)
+	}))
+	defer done()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := http.Get(proxy.URL + "/device/x/filesystem")
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	})
+}
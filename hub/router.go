@@ -0,0 +1,224 @@
+package hub
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	sdk "github.com/deviceio/sdk/go-sdk"
+)
+
+// ProxyUpstream is a hub served by the proxy in addition to the default hub,
+// signed with the credentials of its own profile.
+type ProxyUpstream struct {
+	// Name identifies the upstream on the status page and in logs, normally
+	// the name of the profile it was loaded from.
+	Name string
+
+	// PathPrefix routes requests whose path starts with it. The prefix is
+	// removed before the request is forwarded.
+	PathPrefix string
+
+	// Host routes requests whose Host header matches it, ignoring the port.
+	Host string
+
+	HubHost string
+	HubPort int
+	HubTLS  *tls.Config
+	Auth    *sdk.ClientAuth
+
+	// Transport carries requests to the hub. Defaults to a transport of its
+	// own configured with HubTLS.
+	Transport *http.Transport
+}
+
+func (t *ProxyUpstream) url() *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(t.HubHost, strconv.Itoa(t.HubPort)),
+		Path:   "/",
+	}
+}
+
+func (t *ProxyUpstream) route() string {
+	switch {
+	case t.Host != "":
+		return "host " + t.Host
+	case t.PathPrefix != "":
+		return "path " + t.PathPrefix
+	default:
+		return "default"
+	}
+}
+
+type proxyRoute struct {
+	upstream  *ProxyUpstream
+	transport *http.Transport
+	handler   http.Handler
+	health    *upstreamHealth
+}
+
+// proxyRouter dispatches requests to upstream hubs. Host routes are matched
+// first, then the longest matching path prefix, then the default hub.
+type proxyRouter struct {
+	hosts    map[string]*proxyRoute
+	prefixes []*proxyRoute
+	fallback *proxyRoute
+	routes   []*proxyRoute
+	policy   *ProxyPolicy
+}
+
+func newProxyRouter(config *ProxyConfig) (*proxyRouter, error) {
+	router := &proxyRouter{
+		hosts:  map[string]*proxyRoute{},
+		policy: config.Policy,
+	}
+
+	if config.HubHost != "" {
+		router.fallback = router.add(&ProxyUpstream{
+			Name:    "default",
+			HubHost: config.HubHost,
+			HubPort: config.HubPort,
+			HubTLS:  config.HubTLS,
+			Auth:    config.Auth,
+
+			Transport: config.Transport,
+		})
+	}
+
+	for _, upstream := range config.Upstreams {
+		switch {
+		case upstream.Host != "":
+			host := strings.ToLower(upstream.Host)
+
+			if _, ok := router.hosts[host]; ok {
+				return nil, fmt.Errorf("host %v is routed to more than one hub", upstream.Host)
+			}
+
+			router.hosts[host] = router.add(upstream)
+		case upstream.PathPrefix != "":
+			upstream.PathPrefix = "/" + strings.Trim(upstream.PathPrefix, "/")
+
+			if upstream.PathPrefix == "/" || strings.HasPrefix(upstream.PathPrefix, "/_proxy") {
+				return nil, fmt.Errorf("path prefix %v is reserved", upstream.PathPrefix)
+			}
+
+			for _, route := range router.prefixes {
+				if route.upstream.PathPrefix == upstream.PathPrefix {
+					return nil, fmt.Errorf("path prefix %v is routed to more than one hub", upstream.PathPrefix)
+				}
+			}
+
+			router.prefixes = append(router.prefixes, router.add(upstream))
+		default:
+			return nil, fmt.Errorf("hub %v needs either a path prefix or a host to route by", upstream.Name)
+		}
+	}
+
+	if len(router.routes) == 0 {
+		return nil, fmt.Errorf("no hub is configured")
+	}
+
+	sort.SliceStable(router.prefixes, func(i, j int) bool {
+		return len(router.prefixes[i].upstream.PathPrefix) > len(router.prefixes[j].upstream.PathPrefix)
+	})
+
+	return router, nil
+}
+
+func (t *proxyRouter) add(upstream *ProxyUpstream) *proxyRoute {
+	transport := upstream.Transport
+
+	if transport == nil {
+		transport = &http.Transport{
+			TLSClientConfig: upstream.HubTLS,
+		}
+	}
+
+	// The policy is applied per route so it sees the path the hub receives,
+	// after a path prefix is removed.
+	handler := newUpstreamHandler(upstream, transport)
+
+	if t.policy != nil {
+		handler = t.policy.handler(handler)
+	}
+
+	route := &proxyRoute{
+		upstream:  upstream,
+		transport: transport,
+		handler:   handler,
+		health:    &upstreamHealth{},
+	}
+
+	t.routes = append(t.routes, route)
+
+	return route
+}
+
+func (t *proxyRouter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	host := r.Host
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if route, ok := t.hosts[strings.ToLower(host)]; ok {
+		// The client addressed the proxy by the route's alias, which means
+		// nothing to the hub, so the hub's own address is signed instead.
+		r.Host = route.upstream.url().Host
+		route.handler.ServeHTTP(rw, r)
+		return
+	}
+
+	for _, route := range t.prefixes {
+		prefix := route.upstream.PathPrefix
+
+		if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			continue
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		r2.URL.RawPath = ""
+
+		route.handler.ServeHTTP(rw, r2)
+		return
+	}
+
+	if t.fallback != nil {
+		t.fallback.handler.ServeHTTP(rw, r)
+		return
+	}
+
+	http.Error(rw, "no hub is routed for this request", http.StatusNotFound)
+}
+
+func newUpstreamHandler(upstream *ProxyUpstream, transport http.RoundTripper) http.Handler {
+	rp := httputil.NewSingleHostReverseProxy(upstream.url())
+	rpdir := rp.Director
+	rp.Director = func(r *http.Request) {
+		rpdir(r)
+		upstream.Auth.Sign(r)
+	}
+
+	rp.Transport = transport
+
+	// Process output and file reads are long-lived streams, so every write
+	// is flushed to the client as soon as it arrives from the hub.
+	rp.FlushInterval = -1
+	rp.BufferPool = proxyBufferPool
+	rp.ErrorLog = log.New(logrus.StandardLogger().WriterLevel(logrus.WarnLevel), "", 0)
+
+	return rp
+}
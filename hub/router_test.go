@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoUser replies with the user the request was signed for and the path
+// the hub received.
+var echoUser = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+	userid := strings.SplitN(strings.TrimPrefix(r.Header.Get("Authorization"), "DEVICEIO-HUB-AUTH "), ":", 2)[0]
+	rw.Write([]byte(userid + " " + r.URL.Path))
+})
+
+func TestProxyRoutesByPathPrefixAndHost(t *testing.T) {
+	prod, closeProd := newTestUpstream(t, "prod", echoUser)
+	defer closeProd()
+
+	stag, closeStag := newTestUpstream(t, "stag", echoUser)
+	defer closeStag()
+	stag.PathPrefix = "/staging/"
+
+	edge, closeEdge := newTestUpstream(t, "edge", echoUser)
+	defer closeEdge()
+	edge.Host = "edge.local"
+
+	proxy := newTestProxyServer(t, &ProxyConfig{
+		HubHost:   prod.HubHost,
+		HubPort:   prod.HubPort,
+		HubTLS:    prod.HubTLS,
+		Auth:      prod.Auth,
+		Upstreams: []*ProxyUpstream{stag, edge},
+	})
+	defer proxy.Close()
+
+	cases := []struct {
+		host     string
+		path     string
+		expected string
+	}{
+		{"", "/device/x", "prod /device/x"},
+		{"", "/staging/device/x", "stag /device/x"},
+		{"", "/staging", "stag /"},
+		{"", "/stagingx/device", "prod /stagingx/device"},
+		{"edge.local:8443", "/staging/device/x", "edge /staging/device/x"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+c.path, nil)
+
+		if c.host != "" {
+			req.Host = c.host
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != c.expected {
+			t.Errorf("%v%v: expected %q, got %q", c.host, c.path, c.expected, body)
+		}
+	}
+}
+
+func TestProxyPolicyMatchesRoutedPaths(t *testing.T) {
+	prod, closeProd := newTestUpstream(t, "prod", echoUser)
+	defer closeProd()
+
+	stag, closeStag := newTestUpstream(t, "stag", echoUser)
+	defer closeStag()
+	stag.PathPrefix = "/staging"
+
+	edge, closeEdge := newTestUpstream(t, "edge", echoUser)
+	defer closeEdge()
+	edge.Host = "edge.local"
+
+	proxy := newTestProxyServer(t, &ProxyConfig{
+		HubHost:   prod.HubHost,
+		HubPort:   prod.HubPort,
+		HubTLS:    prod.HubTLS,
+		Auth:      prod.Auth,
+		Upstreams: []*ProxyUpstream{stag, edge},
+		Policy: &ProxyPolicy{
+			Default: policyAllow,
+			Rules: []*ProxyRule{
+				{Action: policyDeny, Paths: []string{"/user/**"}},
+			},
+		},
+	})
+	defer proxy.Close()
+
+	cases := []struct {
+		host     string
+		path     string
+		expected int
+	}{
+		{"", "/user/x", http.StatusForbidden},
+		{"", "/staging/user/x", http.StatusForbidden},
+		{"", "/staging/device/x", http.StatusOK},
+		{"edge.local", "/user/x", http.StatusForbidden},
+		{"", "/staging/users", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+c.path, nil)
+
+		if c.host != "" {
+			req.Host = c.host
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != c.expected {
+			t.Errorf("%v%v: expected status %v, got %v", c.host, c.path, c.expected, resp.StatusCode)
+		}
+	}
+}
+
+func TestProxyStatusReportsHealth(t *testing.T) {
+	prod, closeProd := newTestUpstream(t, "prod", echoUser)
+	defer closeProd()
+
+	down, closeDown := newTestUpstream(t, "down", echoUser)
+	down.PathPrefix = "/down"
+	closeDown()
+
+	config := &ProxyConfig{
+		HubHost:   prod.HubHost,
+		HubPort:   prod.HubPort,
+		HubTLS:    prod.HubTLS,
+		Auth:      prod.Auth,
+		Upstreams: []*ProxyUpstream{down},
+	}
+
+	router, err := newProxyRouter(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range router.routes {
+		route.check(5 * time.Second)
+	}
+
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, statusPath+"?format=json", nil)
+	router.statusHandler(router).ServeHTTP(rw, req)
+
+	statuses := []*upstreamStatus{}
+
+	if err := json.Unmarshal(rw.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 hubs, got %v", len(statuses))
+	}
+
+	if statuses[0].Name != "default" || !statuses[0].Healthy || statuses[0].Status != http.StatusOK {
+		t.Errorf("expected default hub to be healthy, got %+v", statuses[0])
+	}
+
+	if statuses[1].Name != "down" || statuses[1].Healthy || statuses[1].Error == "" || statuses[1].Route != "path /down" {
+		t.Errorf("expected down hub to be unhealthy, got %+v", statuses[1])
+	}
+}
+
+func TestProxyRouterRejectsAmbiguousRoutes(t *testing.T) {
+	a, closeA := newTestUpstream(t, "a", echoUser)
+	defer closeA()
+
+	b, closeB := newTestUpstream(t, "b", echoUser)
+	defer closeB()
+
+	a.PathPrefix = "/stage"
+	b.PathPrefix = "stage/"
+
+	if _, err := newProxyRouter(&ProxyConfig{Upstreams: []*ProxyUpstream{a, b}}); err == nil {
+		t.Error("expected duplicate path prefixes to be rejected")
+	}
+
+	b.PathPrefix = "/_proxy"
+
+	if _, err := newProxyRouter(&ProxyConfig{Upstreams: []*ProxyUpstream{b}}); err == nil {
+		t.Error("expected reserved path prefix to be rejected")
+	}
+}
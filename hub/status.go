@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const statusPath = "/_proxy/status"
+
+type upstreamStatus struct {
+	Name      string    `json:"name"`
+	Route     string    `json:"route"`
+	Hub       string    `json:"hub"`
+	UserID    string    `json:"user_id"`
+	Healthy   bool      `json:"healthy"`
+	Status    int       `json:"status,omitempty"`
+	LatencyMS float64   `json:"latency_ms"`
+	Checked   time.Time `json:"checked"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>deviceio hub proxy</title></head>
+<body>
+<h1>deviceio hub proxy</h1>
+<table border="1" cellpadding="4">
+<tr><th>Name</th><th>Route</th><th>Hub</th><th>User</th><th>Health</th><th>Status</th><th>Latency</th><th>Checked</th><th>Error</th></tr>
+{{range .}}<tr>
+<td>{{.Name}}</td><td>{{.Route}}</td><td>{{.Hub}}</td><td>{{.UserID}}</td>
+<td>{{if .Checked.IsZero}}pending{{else if .Healthy}}healthy{{else}}unhealthy{{end}}</td>
+<td>{{if .Status}}{{.Status}}{{end}}</td><td>{{printf "%.1f" .LatencyMS}}ms</td>
+<td>{{if not .Checked.IsZero}}{{.Checked.Format "2006-01-02 15:04:05"}}{{end}}</td><td>{{.Error}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (t *proxyRouter) status() []*upstreamStatus {
+	statuses := []*upstreamStatus{}
+
+	for _, route := range t.routes {
+		health := route.health.snapshot()
+
+		statuses = append(statuses, &upstreamStatus{
+			Name:      route.upstream.Name,
+			Route:     route.upstream.route(),
+			Hub:       route.upstream.url().Host,
+			UserID:    route.upstream.Auth.UserID,
+			Healthy:   health.Healthy,
+			Status:    health.Status,
+			LatencyMS: float64(health.Latency) / float64(time.Millisecond),
+			Checked:   health.Checked,
+			Error:     health.Error,
+		})
+	}
+
+	return statuses
+}
+
+// statusHandler serves the status page ahead of the policy, which only
+// governs what is forwarded to the hubs.
+func (t *proxyRouter) statusHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != statusPath {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			rw.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(rw).Encode(t.status())
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		statusTemplate.Execute(rw, t.status())
+	})
+}
@@ -0,0 +1,250 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/cli/output"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+// SubmitField is a form field given on the command line as name=value. The
+// value of an octet-stream field is the path of a file to upload, optionally
+// prefixed with '@'; '@-' uploads stdin.
+type SubmitField struct {
+	Name  string
+	Type  hmapi.MediaType
+	Value string
+}
+
+// ParseSubmitFields parses name=value arguments into fields of one type.
+func ParseSubmitFields(media hmapi.MediaType, args []string) ([]*SubmitField, error) {
+	fields := []*SubmitField{}
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected name=value, got '%v'", arg)
+		}
+
+		field := &SubmitField{
+			Name:  parts[0],
+			Type:  media,
+			Value: parts[1],
+		}
+
+		if media == hmapi.MediaTypeOctetStream {
+			field.Value = strings.TrimPrefix(field.Value, "@")
+		} else if _, err := parseFieldValue(field.Name, media, field.Value); err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// Submit submits a form of the resource at path and streams the response
+// body to stdout. With include the status line, headers and trailers are
+// printed around the body.
+func Submit(c hmapi.Client, path, form string, fields []*SubmitField, include bool) error {
+	res, err := c.Resource(path).Get(context.Background())
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to get %v", path)
+	}
+
+	declared := declaredTypes(res.Forms[form])
+	request := c.Resource(path).Form(form)
+
+	for _, field := range fields {
+		if field.Type != hmapi.MediaTypeOctetStream {
+			// The command line only tells strings, ints and booleans apart,
+			// so values are sent as the type the form declares.
+			media := field.Type
+
+			if d := declared[field.Name]; d != "" && d != hmapi.MediaTypeOctetStream {
+				media = d
+			}
+
+			if err := addFormField(request, field.Name, media, field.Value); err != nil {
+				return stacktrace.PropagateWithCode(err, exitcode.Usage, "")
+			}
+
+			continue
+		}
+
+		if field.Value == "-" {
+			request.AddFieldAsOctetStream(field.Name, os.Stdin)
+			continue
+		}
+
+		f, err := os.Open(field.Value)
+
+		if os.IsNotExist(err) {
+			return stacktrace.PropagateWithCode(err, exitcode.NotFound, "")
+		}
+
+		if err != nil {
+			return stacktrace.Propagate(err, "failed to open %v", field.Value)
+		}
+		defer f.Close()
+
+		request.AddFieldAsOctetStream(field.Name, f)
+	}
+
+	resp, err := request.Submit(context.Background())
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to submit form %v of %v", form, path)
+	}
+
+	return writeResponse(resp.Response, include)
+}
+
+// declaredTypes maps the fields of form to their declared media types.
+func declaredTypes(form *hmapi.Form) map[string]hmapi.MediaType {
+	types := map[string]hmapi.MediaType{}
+
+	if form == nil {
+		return types
+	}
+
+	for _, field := range form.Fields {
+		types[field.Name] = field.Type
+	}
+
+	return types
+}
+
+// addFormField adds text to the request as a value of the given media type.
+// Fields of media types hmapi does not know are sent as strings.
+func addFormField(request hmapi.FormRequest, name string, media hmapi.MediaType, text string) error {
+	value, err := parseFieldValue(name, media, text)
+
+	if err != nil {
+		return err
+	}
+
+	if s, ok := value.(string); ok {
+		request.AddFieldAsString(name, s)
+	} else {
+		request.AddField(name, media, value)
+	}
+
+	return nil
+}
+
+// parseFieldValue converts text into the Go type hmapi expects for a field of
+// the given media type. Unknown media types are passed on as strings.
+func parseFieldValue(name string, media hmapi.MediaType, text string) (interface{}, error) {
+	var value interface{}
+	var err error
+	var expected string
+
+	switch media {
+	case hmapi.MediaTypeHMAPIBoolean:
+		value, err = strconv.ParseBool(text)
+		expected = "true or false"
+	case hmapi.MediaTypeHMAPIInt:
+		value, err = strconv.Atoi(text)
+		expected = "an integer"
+	case hmapi.MediaTypeHMAPIInt32:
+		var i int64
+		i, err = strconv.ParseInt(text, 10, 32)
+		value, expected = int32(i), "a 32-bit integer"
+	case hmapi.MediaTypeHMAPIInt64:
+		value, err = strconv.ParseInt(text, 10, 64)
+		expected = "a 64-bit integer"
+	case hmapi.MediaTypeHMAPIUInt:
+		var u uint64
+		u, err = strconv.ParseUint(text, 10, 0)
+		value, expected = uint(u), "an unsigned integer"
+	case hmapi.MediaTypeHMAPIUInt32:
+		var u uint64
+		u, err = strconv.ParseUint(text, 10, 32)
+		value, expected = uint32(u), "an unsigned 32-bit integer"
+	case hmapi.MediaTypeHMAPIUInt64:
+		value, err = strconv.ParseUint(text, 10, 64)
+		expected = "an unsigned 64-bit integer"
+	case hmapi.MediaTypeHMAPIFloat32:
+		var f float64
+		f, err = strconv.ParseFloat(text, 32)
+		value, expected = float32(f), "a number"
+	case hmapi.MediaTypeHMAPIFloat64:
+		value, err = strconv.ParseFloat(text, 64)
+		expected = "a number"
+	default:
+		return text, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("field %v: '%v' is not %v", name, text, expected)
+	}
+
+	return value, nil
+}
+
+// Get renders the resource at path or, when link is given, follows the link
+// and streams its response body to stdout.
+func Get(c hmapi.Client, path, link string, include bool, out *output.Renderer) error {
+	if link != "" {
+		resp, err := c.Resource(path).Link(link).Get(context.Background())
+
+		if err != nil {
+			return stacktrace.Propagate(err, "failed to follow link %v of %v", link, path)
+		}
+
+		return writeResponse(resp.Response, include)
+	}
+
+	res, err := c.Resource(path).Get(context.Background())
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to get %v", path)
+	}
+
+	return out.Render(res)
+}
+
+// writeResponse streams resp to stdout. A status of 300 or above and an
+// Error trailer are returned as errors once the body is written.
+func writeResponse(resp *http.Response, include bool) error {
+	defer resp.Body.Close()
+
+	if include {
+		fmt.Printf("%v %v\r\n", resp.Proto, resp.Status)
+		resp.Header.Write(os.Stdout)
+		fmt.Print("\r\n")
+	}
+
+	buf := make([]byte, 250000)
+
+	if _, err := io.CopyBuffer(os.Stdout, resp.Body, buf); err != nil {
+		return stacktrace.PropagateWithCode(err, exitcode.TransferIncomplete, "failed to read response of %v %v", resp.Request.Method, resp.Request.URL.Path)
+	}
+
+	if include && len(resp.Trailer) > 0 {
+		fmt.Print("\r\n")
+		resp.Trailer.Write(os.Stdout)
+	}
+
+	if resp.StatusCode >= 300 {
+		return stacktrace.NewErrorWithCode(exitcode.FromStatus(resp.StatusCode), "%v %v: %v", resp.Request.Method, resp.Request.URL.Path, exitcode.Response(resp.StatusCode, nil))
+	}
+
+	if trailerError := resp.Trailer.Get("Error"); trailerError != "" {
+		return stacktrace.NewErrorWithCode(exitcode.TransferIncomplete, "%v %v: %v", resp.Request.Method, resp.Request.URL.Path, trailerError)
+	}
+
+	return nil
+}
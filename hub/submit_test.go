@@ -0,0 +1,242 @@
+package hub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/hmapi"
+)
+
+func TestParseSubmitFields(t *testing.T) {
+	cases := []struct {
+		media    hmapi.MediaType
+		args     []string
+		expected []*SubmitField
+		err      string
+	}{
+		{
+			media: hmapi.MediaTypeHMAPIString,
+			args:  []string{"name=web-1", "query=a=b", "empty="},
+			expected: []*SubmitField{
+				{Name: "name", Type: hmapi.MediaTypeHMAPIString, Value: "web-1"},
+				{Name: "query", Type: hmapi.MediaTypeHMAPIString, Value: "a=b"},
+				{Name: "empty", Type: hmapi.MediaTypeHMAPIString, Value: ""},
+			},
+		},
+		{
+			media: hmapi.MediaTypeOctetStream,
+			args:  []string{"data=@motd.txt", "raw=-", "plain=motd.txt"},
+			expected: []*SubmitField{
+				{Name: "data", Type: hmapi.MediaTypeOctetStream, Value: "motd.txt"},
+				{Name: "raw", Type: hmapi.MediaTypeOctetStream, Value: "-"},
+				{Name: "plain", Type: hmapi.MediaTypeOctetStream, Value: "motd.txt"},
+			},
+		},
+		{
+			media:    hmapi.MediaTypeHMAPIInt,
+			args:     []string{"count=-3"},
+			expected: []*SubmitField{{Name: "count", Type: hmapi.MediaTypeHMAPIInt, Value: "-3"}},
+		},
+		{media: hmapi.MediaTypeHMAPIString, args: []string{"name"}, err: "expected name=value, got 'name'"},
+		{media: hmapi.MediaTypeHMAPIString, args: []string{"=value"}, err: "expected name=value, got '=value'"},
+		{media: hmapi.MediaTypeHMAPIInt, args: []string{"count=three"}, err: "field count: 'three' is not an integer"},
+		{media: hmapi.MediaTypeHMAPIBoolean, args: []string{"force=maybe"}, err: "field force: 'maybe' is not true or false"},
+		{media: hmapi.MediaTypeHMAPIInt32, args: []string{"n=4294967296"}, err: "field n: '4294967296' is not a 32-bit integer"},
+		{media: hmapi.MediaTypeHMAPIUInt, args: []string{"n=-1"}, err: "field n: '-1' is not an unsigned integer"},
+		{media: hmapi.MediaTypeHMAPIFloat64, args: []string{"load=high"}, err: "field load: 'high' is not a number"},
+	}
+
+	for _, c := range cases {
+		fields, err := ParseSubmitFields(c.media, c.args)
+
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%v: expected error %q, got %v", c.args, c.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: %v", c.args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(fields, c.expected) {
+			t.Errorf("%v: expected %+v, got %+v", c.args, c.expected, fields)
+		}
+	}
+}
+
+// submitHub stands in for a hub with an upload form at /device/d1/upload.
+// The form declares a default for the mode field, and the hub records the
+// names and values of the multipart parts it receives in order.
+func submitHub(t *testing.T, parts *[]string) (hmapi.Client, func()) {
+	hub := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Content-Type", hmapi.MediaTypeHMAPIResource.String())
+			rw.Write([]byte(`{"forms":{"upload":{"action":"/device/d1/upload","method":"POST","enctype":"multipart/form-data","fields":[
+				{"name":"mode","type":"application/vnd.hmapi.String","value":"fast"},
+				{"name":"name","type":"application/vnd.hmapi.String"},
+				{"name":"count","type":"application/vnd.hmapi.Int"},
+				{"name":"limit","type":"application/vnd.hmapi.Int64"},
+				{"name":"ratio","type":"application/vnd.hmapi.Float32"},
+				{"name":"data","type":"application/octet-stream"}
+			]}}}`))
+			return
+		}
+
+		reader, err := r.MultipartReader()
+
+		if err != nil {
+			t.Errorf("expected a multipart body: %v", err)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for {
+			part, err := reader.NextPart()
+
+			if err != nil {
+				break
+			}
+
+			value, _ := ioutil.ReadAll(part)
+			*parts = append(*parts, part.FormName()+"="+string(value))
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+
+	target, _ := url.Parse(hub.URL)
+	port, _ := strconv.Atoi(target.Port())
+
+	return hmapi.NewClient(&hmapi.ClientConfig{
+		Host: target.Hostname(),
+		Port: port,
+	}), hub.Close
+}
+
+// TestSubmitSendsUploadsLast checks that fields are sent in the order given,
+// after the declared defaults, so an upload given last ends the body.
+func TestSubmitSendsUploadsLast(t *testing.T) {
+	dir, err := ioutil.TempDir("", "submit")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "motd.txt")
+
+	if err := ioutil.WriteFile(path, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := []string{}
+	c, done := submitHub(t, &parts)
+	defer done()
+
+	fields := []*SubmitField{
+		{Name: "name", Type: hmapi.MediaTypeHMAPIString, Value: "web-1"},
+		{Name: "count", Type: hmapi.MediaTypeHMAPIInt, Value: "3"},
+		{Name: "data", Type: hmapi.MediaTypeOctetStream, Value: path},
+	}
+
+	if err := Submit(c, "/device/d1", "upload", fields, false); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"mode=fast", "name=web-1", "count=3", "data=hello"}
+
+	if !reflect.DeepEqual(parts, expected) {
+		t.Errorf("expected parts %v, got %v", expected, parts)
+	}
+}
+
+// TestSubmitConvertsToDeclaredTypes checks that values given as ints or
+// strings are sent as the numeric type their field declares.
+func TestSubmitConvertsToDeclaredTypes(t *testing.T) {
+	parts := []string{}
+	c, done := submitHub(t, &parts)
+	defer done()
+
+	fields := []*SubmitField{
+		{Name: "limit", Type: hmapi.MediaTypeHMAPIInt, Value: "5000000000"},
+		{Name: "ratio", Type: hmapi.MediaTypeHMAPIString, Value: "0.5"},
+	}
+
+	if err := Submit(c, "/device/d1", "upload", fields, false); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"mode=fast", "limit=5000000000", "ratio=0.5"}
+
+	if !reflect.DeepEqual(parts, expected) {
+		t.Errorf("expected parts %v, got %v", expected, parts)
+	}
+}
+
+func TestSubmitReportsFieldErrors(t *testing.T) {
+	parts := []string{}
+	client, done := submitHub(t, &parts)
+	defer done()
+
+	cases := []struct {
+		field   *SubmitField
+		code    int
+		message string
+	}{
+		{
+			field:   &SubmitField{Name: "count", Type: hmapi.MediaTypeHMAPIInt, Value: "three"},
+			code:    int(exitcode.Usage),
+			message: "'three' is not an integer",
+		},
+		{
+			field:   &SubmitField{Name: "data", Type: hmapi.MediaTypeOctetStream, Value: "/no/such/file"},
+			code:    int(exitcode.NotFound),
+			message: "/no/such/file",
+		},
+		{
+			field:   &SubmitField{Name: "limit", Type: hmapi.MediaTypeHMAPIInt, Value: "99999999999999999999"},
+			code:    int(exitcode.Usage),
+			message: "'99999999999999999999' is not a 64-bit integer",
+		},
+		{
+			field:   &SubmitField{Name: "size", Type: hmapi.MediaTypeHMAPIInt, Value: "3"},
+			code:    int(exitcode.Usage),
+			message: "unknown field 'size'",
+		},
+	}
+
+	for _, c := range cases {
+		err := Submit(client, "/device/d1", "upload", []*SubmitField{c.field}, false)
+
+		if err == nil {
+			t.Errorf("%v: expected an error", c.field.Name)
+			continue
+		}
+
+		if code := exitcode.Of(err); code != c.code {
+			t.Errorf("%v: expected exit code %v, got %v: %v", c.field.Name, c.code, code, err)
+		}
+
+		if !strings.Contains(err.Error(), c.message) {
+			t.Errorf("%v: expected %q in %q", c.field.Name, c.message, err.Error())
+		}
+	}
+
+	if len(parts) != 0 {
+		t.Errorf("expected nothing to be submitted, got %v", parts)
+	}
+}
@@ -0,0 +1,463 @@
+// Package output renders the results of structured commands. Every command
+// producing data rather than a byte stream writes it through a Renderer, so
+// results can be read as an aligned table, JSON, NDJSON or YAML, narrowed
+// with a jsonpath query or formatted with a Go template.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/deviceio/cli/exitcode"
+	isatty "github.com/mattn/go-isatty"
+	"github.com/palantir/stacktrace"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Format is a way of writing results.
+type Format string
+
+const (
+	// Table writes results as aligned columns, or in the command's own text
+	// layout. Results without either are written as indented JSON.
+	Table Format = "table"
+
+	// JSON writes a result as indented JSON and a list of results as an
+	// array.
+	JSON Format = "json"
+
+	// NDJSON writes every result as one line of JSON as soon as it is
+	// rendered.
+	NDJSON Format = "ndjson"
+
+	// YAML writes a result as a YAML document and a list of results as a
+	// sequence.
+	YAML Format = "yaml"
+)
+
+// Formats lists the names accepted for --output.
+var Formats = []string{string(Table), string(JSON), string(NDJSON), string(YAML)}
+
+// Options selects how a Renderer writes results.
+type Options struct {
+	// Format defaults to Table.
+	Format Format
+
+	// Template is a Go template executed for every result in place of the
+	// format. A newline is added to output not ending in one.
+	Template string
+
+	// Query is a jsonpath query selecting the values rendered from every
+	// result.
+	Query string
+
+	// Color enables terminal colors in table output.
+	Color bool
+}
+
+// Column is a table column. Path is a query selecting the column's value
+// from each result.
+type Column struct {
+	Header string
+	Path   string
+}
+
+// Renderer writes the results of a command. A command either renders one
+// result with Render, or adds the results of a list with Add and ends the
+// list with Flush.
+type Renderer struct {
+	out      io.Writer
+	format   Format
+	template *template.Template
+	query    *Query
+	color    bool
+	columns  []Column
+	text     func(io.Writer, interface{}) error
+	single   bool
+	values   []interface{}
+}
+
+// New returns a Renderer writing to out.
+func New(out io.Writer, options *Options) (*Renderer, error) {
+	r := &Renderer{
+		out:    out,
+		format: options.Format,
+		color:  options.Color,
+	}
+
+	switch r.format {
+	case "":
+		r.format = Table
+	case Table, JSON, NDJSON, YAML:
+	default:
+		return nil, stacktrace.NewErrorWithCode(exitcode.Usage, "unknown output format '%v'. Valid formats are: %v", r.format, strings.Join(Formats, ", "))
+	}
+
+	if options.Template != "" {
+		tmpl, err := template.New("output").Funcs(templateFuncs).Parse(options.Template)
+
+		if err != nil {
+			return nil, stacktrace.PropagateWithCode(err, exitcode.Usage, "invalid template")
+		}
+
+		r.template = tmpl
+	}
+
+	if options.Query != "" {
+		query, err := ParseQuery(options.Query)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.query = query
+	}
+
+	return r, nil
+}
+
+// Color reports whether colors should be written to f: it must be a
+// terminal and NO_COLOR must not be set.
+func Color(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		jsonb, err := json.Marshal(v)
+		return string(jsonb), err
+	},
+}
+
+// Format returns the format results are written in.
+func (t *Renderer) Format() Format {
+	return t.format
+}
+
+// Columns sets the columns of table output.
+func (t *Renderer) Columns(columns ...Column) *Renderer {
+	t.columns = columns
+	return t
+}
+
+// Text sets the layout of table output for results that do not fit in
+// columns. It is called with each result.
+func (t *Renderer) Text(text func(w io.Writer, value interface{}) error) *Renderer {
+	t.text = text
+	return t
+}
+
+// Render writes a single result.
+func (t *Renderer) Render(value interface{}) error {
+	t.single = true
+
+	if err := t.Add(value); err != nil {
+		return err
+	}
+
+	return t.Flush()
+}
+
+// Add renders one result of a list. Templates and NDJSON are written
+// straight away; the other formats are written by Flush.
+func (t *Renderer) Add(value interface{}) error {
+	values := []interface{}{value}
+
+	if t.query != nil || t.template != nil {
+		plain, err := plainValue(value)
+
+		if err != nil {
+			return err
+		}
+
+		values = []interface{}{plain}
+
+		if t.query != nil {
+			values = t.query.Select(plain)
+		}
+	}
+
+	for _, v := range values {
+		switch {
+		case t.template != nil:
+			if err := t.writeTemplate(v); err != nil {
+				return err
+			}
+		case t.format == NDJSON:
+			jsonb, err := json.Marshal(v)
+
+			if err != nil {
+				return stacktrace.Propagate(err, "failed to encode result")
+			}
+
+			if _, err := fmt.Fprintf(t.out, "%s\n", jsonb); err != nil {
+				return stacktrace.Propagate(err, "failed to write result")
+			}
+		default:
+			t.values = append(t.values, v)
+		}
+	}
+
+	return nil
+}
+
+// Flush writes the results added since the last Flush.
+func (t *Renderer) Flush() error {
+	values := t.values
+	t.values = nil
+
+	if values == nil {
+		values = []interface{}{}
+	}
+
+	if t.template != nil {
+		return nil
+	}
+
+	// A single result is written as is unless a query may have selected
+	// several values from it.
+	var result interface{} = values
+
+	if t.single && (t.query == nil || t.query.Definite()) {
+		result = nil
+
+		if len(values) > 0 {
+			result = values[0]
+		}
+	}
+
+	switch t.format {
+	case JSON:
+		return t.writeJSON(result)
+
+	case YAML:
+		plain, err := plainValue(result)
+
+		if err != nil {
+			return err
+		}
+
+		yamlb, err := yaml.Marshal(plain)
+
+		if err != nil {
+			return stacktrace.Propagate(err, "failed to encode result")
+		}
+
+		return t.write(yamlb)
+
+	case Table:
+		switch {
+		case t.query != nil:
+		case t.text != nil:
+			for _, v := range values {
+				if err := t.text(t.out, v); err != nil {
+					return stacktrace.Propagate(err, "failed to write result")
+				}
+			}
+
+			return nil
+		case t.columns != nil:
+			return t.writeTable(values)
+		}
+
+		for _, v := range values {
+			if err := t.writeValue(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *Renderer) writeJSON(value interface{}) error {
+	jsonb, err := json.MarshalIndent(value, "", "    ")
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to encode result")
+	}
+
+	return t.write(append(jsonb, '\n'))
+}
+
+// writeValue writes a value without columns: scalars as text and anything
+// else as indented JSON.
+func (t *Renderer) writeValue(value interface{}) error {
+	switch value.(type) {
+	case nil:
+		return nil
+	case string, bool, int, int32, int64, uint, uint32, uint64, float32, float64, json.Number:
+		return t.write([]byte(fmt.Sprintln(value)))
+	}
+
+	return t.writeJSON(value)
+}
+
+func (t *Renderer) writeTemplate(value interface{}) error {
+	buf := &bytes.Buffer{}
+
+	if err := t.template.Execute(buf, value); err != nil {
+		return stacktrace.PropagateWithCode(err, exitcode.Usage, "failed to execute template")
+	}
+
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	return t.write(buf.Bytes())
+}
+
+// writeTable aligns the columns of values. Colors are escape sequences the
+// width of a cell must not include, so cells are padded here rather than by
+// tabwriter.
+func (t *Renderer) writeTable(values []interface{}) error {
+	rows := [][]string{{}}
+
+	for _, column := range t.columns {
+		rows[0] = append(rows[0], column.Header)
+	}
+
+	queries := []*Query{}
+
+	for _, column := range t.columns {
+		query, err := ParseQuery(column.Path)
+
+		if err != nil {
+			return err
+		}
+
+		queries = append(queries, query)
+	}
+
+	for _, value := range values {
+		plain, err := plainValue(value)
+
+		if err != nil {
+			return err
+		}
+
+		row := []string{}
+
+		for _, query := range queries {
+			cells := []string{}
+
+			for _, v := range query.Select(plain) {
+				cells = append(cells, cellText(v))
+			}
+
+			row = append(row, strings.Join(cells, ","))
+		}
+
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(t.columns))
+
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+
+	for i, row := range rows {
+		line := ""
+
+		for j, cell := range row {
+			if j == len(row)-1 {
+				line += cell
+				break
+			}
+
+			line += cell + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)+2)
+		}
+
+		if i == 0 && t.color {
+			line = "\x1b[1m" + line + "\x1b[0m"
+		}
+
+		buf.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+
+	return t.write(buf.Bytes())
+}
+
+func cellText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		jsonb, _ := json.Marshal(v)
+		return string(jsonb)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (t *Renderer) write(b []byte) error {
+	if _, err := t.out.Write(b); err != nil {
+		return stacktrace.Propagate(err, "failed to write result")
+	}
+
+	return nil
+}
+
+// plainValue converts value into the maps, slices and scalars its JSON
+// encoding decodes into, so queries, templates and YAML see the same names
+// as JSON output. Numbers become int64 when they are whole and float64
+// otherwise.
+func plainValue(value interface{}) (interface{}, error) {
+	jsonb, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to encode result")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonb))
+	decoder.UseNumber()
+
+	var plain interface{}
+
+	if err := decoder.Decode(&plain); err != nil {
+		return nil, stacktrace.Propagate(err, "failed to decode result")
+	}
+
+	return plainNumbers(plain), nil
+}
+
+func plainNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, e := range v {
+			v[key] = plainNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = plainNumbers(e)
+		}
+	}
+
+	return value
+}
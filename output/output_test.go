@@ -0,0 +1,267 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+type testDevice struct {
+	ID       string            `json:"id"`
+	Hostname string            `json:"hostname"`
+	Online   bool              `json:"online"`
+	Uptime   int64             `json:"uptime"`
+	Load     float64           `json:"load"`
+	Tags     []string          `json:"tags,omitempty"`
+	Links    map[string]string `json:"links,omitempty"`
+}
+
+var testDevices = []*testDevice{
+	{
+		ID:       "d1",
+		Hostname: "web-1.example.com",
+		Online:   true,
+		Uptime:   86400,
+		Load:     0.25,
+		Tags:     []string{"web", "eu"},
+		Links:    map[string]string{"process": "/device/d1/process", "filesystem": "/device/d1/filesystem"},
+	},
+	{
+		ID:       "d2",
+		Hostname: "db-1",
+		Online:   false,
+		Uptime:   12,
+		Load:     1.5,
+	},
+}
+
+var testColumns = []Column{
+	{Header: "ID", Path: "id"},
+	{Header: "HOSTNAME", Path: "hostname"},
+	{Header: "ONLINE", Path: "online"},
+	{Header: "TAGS", Path: "tags[*]"},
+}
+
+// TestRenderGolden renders the test devices as a list and the first device
+// as a single result in every format, comparing the output with
+// testdata/<name>.golden.
+func TestRenderGolden(t *testing.T) {
+	cases := []struct {
+		name    string
+		options *Options
+		text    func(io.Writer, interface{}) error
+		single  bool
+	}{
+		{name: "table", options: &Options{}},
+		{name: "table_color", options: &Options{Color: true}},
+		{name: "table_text", options: &Options{}, text: func(w io.Writer, value interface{}) error {
+			_, err := fmt.Fprintf(w, "%v is %v\n", value.(*testDevice).Hostname, map[bool]string{true: "online", false: "offline"}[value.(*testDevice).Online])
+			return err
+		}},
+		{name: "table_single", options: &Options{}, single: true},
+		{name: "table_query", options: &Options{Query: "links.*"}},
+		{name: "json", options: &Options{Format: JSON}},
+		{name: "json_single", options: &Options{Format: JSON}, single: true},
+		{name: "json_query", options: &Options{Format: JSON, Query: "$.tags[0]"}, single: true},
+		{name: "ndjson", options: &Options{Format: NDJSON}},
+		{name: "ndjson_query", options: &Options{Format: NDJSON, Query: "{.links}"}},
+		{name: "yaml", options: &Options{Format: YAML}},
+		{name: "yaml_single", options: &Options{Format: YAML}, single: true},
+		{name: "template", options: &Options{Template: `{{.id}} {{.hostname}} {{if .online}}up {{.uptime}}s{{else}}down{{end}} {{json .tags}}`}},
+		{name: "template_query", options: &Options{Template: `{{.}}`, Query: "..tags[*]"}},
+	}
+
+	for _, tc := range cases {
+		out := &bytes.Buffer{}
+		r, err := New(out, tc.options)
+
+		if err != nil {
+			t.Fatalf("%v: %v", tc.name, err)
+		}
+
+		r.Columns(testColumns...)
+
+		if tc.text != nil {
+			r.Text(tc.text)
+		}
+
+		if tc.single {
+			err = r.Render(testDevices[0])
+		} else {
+			for _, device := range testDevices {
+				if err = r.Add(device); err != nil {
+					break
+				}
+			}
+
+			if err == nil {
+				err = r.Flush()
+			}
+		}
+
+		if err != nil {
+			t.Fatalf("%v: %v", tc.name, err)
+		}
+
+		golden := filepath.Join("testdata", tc.name+".golden")
+
+		if *update {
+			if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(out.Bytes(), expected) {
+			t.Errorf("%v: output differs from %v\n%s", tc.name, golden, out.Bytes())
+		}
+	}
+}
+
+func TestNDJSONStreams(t *testing.T) {
+	out := &bytes.Buffer{}
+	r, _ := New(out, &Options{Format: NDJSON})
+
+	if err := r.Add(testDevices[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"id":"d2","hostname":"db-1","online":false,"uptime":12,"load":1.5}` + "\n"; out.String() != expected {
+		t.Fatalf("expected %q before Flush, got %q", expected, out.String())
+	}
+}
+
+func TestEmptyList(t *testing.T) {
+	for format, expected := range map[Format]string{
+		Table:  "ID  HOSTNAME  ONLINE  TAGS\n",
+		JSON:   "[]\n",
+		NDJSON: "",
+		YAML:   "[]\n",
+	} {
+		out := &bytes.Buffer{}
+		r, _ := New(out, &Options{Format: format})
+
+		if err := r.Columns(testColumns...).Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if out.String() != expected {
+			t.Errorf("%v: expected %q, got %q", format, expected, out.String())
+		}
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	for _, options := range []*Options{
+		{Format: "xml"},
+		{Template: "{{.id"},
+		{Query: "links["},
+		{Query: "links..."},
+		{Query: "[x]"},
+	} {
+		if _, err := New(ioutil.Discard, options); err == nil {
+			t.Errorf("%+v: expected an error", options)
+		}
+	}
+}
+
+func TestQuerySelect(t *testing.T) {
+	value := map[string]interface{}{
+		"name": "hub",
+		"items": []interface{}{
+			map[string]interface{}{"id": "a", "size": int64(1)},
+			map[string]interface{}{"id": "b", "size": int64(2)},
+			map[string]interface{}{"id": "c", "size": int64(3)},
+		},
+		"meta": map[string]interface{}{"id": "m", "odd-key": true},
+	}
+
+	cases := map[string][]interface{}{
+		"":                  {value},
+		"$":                 {value},
+		"name":              {"hub"},
+		".name":             {"hub"},
+		"{.name}":           {"hub"},
+		"$['name']":         {"hub"},
+		"missing":           {},
+		"items[1].id":       {"b"},
+		"items[-1].id":      {"c"},
+		"items[5].id":       {},
+		"items[*].size":     {int64(1), int64(2), int64(3)},
+		"items[1:].id":      {"b", "c"},
+		"items[:-1].id":     {"a", "b"},
+		"meta[\"odd-key\"]": {true},
+		"meta.*":            {"m", true},
+		"..id":              {"a", "b", "c", "m"},
+		"name[0]":           {},
+	}
+
+	for text, expected := range cases {
+		query, err := ParseQuery(text)
+
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+
+		if actual := query.Select(value); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %#v, got %#v", text, expected, actual)
+		}
+	}
+}
+
+func TestQueryDefinite(t *testing.T) {
+	for text, expected := range map[string]bool{
+		"a.b[0]":   true,
+		"a[*]":     false,
+		"a.*":      false,
+		"a[1:2]":   false,
+		"..a":      false,
+		"$['a.b']": true,
+	} {
+		query, err := ParseQuery(text)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if query.Definite() != expected {
+			t.Errorf("%q: expected Definite %v", text, expected)
+		}
+	}
+}
+
+func TestColorRespectsNoColorAndTerminals(t *testing.T) {
+	f, err := ioutil.TempFile("", "output")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if Color(f) {
+		t.Error("expected no color for a file")
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	if Color(os.Stdout) {
+		t.Error("expected no color with NO_COLOR set")
+	}
+}
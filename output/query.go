@@ -0,0 +1,300 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/palantir/stacktrace"
+)
+
+// Query selects values from a result with a subset of JSONPath: '.name' and
+// "['name']" select object members, '[n]' and '[start:end]' array elements
+// (negative positions count from the end), '*' every member or element and
+// '..' descends recursively. The leading '$' and kubectl style braces are
+// optional, so 'links.*.href', '$.links.*.href' and '{.links.*.href}' are
+// the same query.
+type Query struct {
+	text  string
+	steps []*queryStep
+}
+
+type queryStep struct {
+	recursive bool
+	wildcard  bool
+	name      string
+	index     *int
+	slice     bool
+	start     *int
+	end       *int
+}
+
+// ParseQuery parses a query.
+func ParseQuery(text string) (*Query, error) {
+	expr := strings.TrimSpace(text)
+
+	if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+
+	expr = strings.TrimPrefix(expr, "$")
+
+	if expr != "" && expr[0] != '.' && expr[0] != '[' {
+		expr = "." + expr
+	}
+
+	q := &Query{text: text}
+
+	for expr != "" {
+		step := &queryStep{}
+
+		switch {
+		case strings.HasPrefix(expr, ".."):
+			step.recursive = true
+			expr = expr[2:]
+
+			if strings.HasPrefix(expr, "[") {
+				break
+			}
+
+			expr = "." + expr
+			fallthrough
+
+		case expr[0] == '.':
+			end := strings.IndexAny(expr[1:], ".[")
+
+			if end < 0 {
+				end = len(expr) - 1
+			}
+
+			name := expr[1 : end+1]
+			expr = expr[end+1:]
+
+			if name == "" {
+				return nil, queryError(text, "expected a member name")
+			}
+
+			if name == "*" {
+				step.wildcard = true
+			} else {
+				step.name = name
+			}
+
+			q.steps = append(q.steps, step)
+			continue
+
+		case expr[0] != '[':
+			return nil, queryError(text, "unexpected '%v'", expr[:1])
+		}
+
+		end := strings.Index(expr, "]")
+
+		if end < 0 {
+			return nil, queryError(text, "missing ']'")
+		}
+
+		if err := step.parseBracket(expr[1:end]); err != nil {
+			return nil, queryError(text, "%v", err)
+		}
+
+		expr = expr[end+1:]
+		q.steps = append(q.steps, step)
+	}
+
+	return q, nil
+}
+
+func (t *queryStep) parseBracket(selector string) error {
+	selector = strings.TrimSpace(selector)
+
+	switch {
+	case selector == "*":
+		t.wildcard = true
+		return nil
+
+	case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+		t.name = selector[1 : len(selector)-1]
+		return nil
+
+	case strings.Contains(selector, ":"):
+		parts := strings.SplitN(selector, ":", 2)
+		t.slice = true
+
+		var err error
+
+		if t.start, err = parsePosition(parts[0]); err != nil {
+			return err
+		}
+
+		t.end, err = parsePosition(parts[1])
+		return err
+	}
+
+	i, err := strconv.Atoi(selector)
+
+	if err != nil {
+		return fmt.Errorf("'%v' is not an index, slice, quoted name or '*'", selector)
+	}
+
+	t.index = &i
+
+	return nil
+}
+
+func parsePosition(text string) (*int, error) {
+	text = strings.TrimSpace(text)
+
+	if text == "" {
+		return nil, nil
+	}
+
+	i, err := strconv.Atoi(text)
+
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not an index", text)
+	}
+
+	return &i, nil
+}
+
+func queryError(query, format string, args ...interface{}) error {
+	return stacktrace.NewErrorWithCode(exitcode.Usage, "invalid query '%v': %v", query, fmt.Sprintf(format, args...))
+}
+
+// Definite reports whether the query selects at most one value, that is it
+// has no wildcard, slice or recursive step.
+func (t *Query) Definite() bool {
+	for _, step := range t.steps {
+		if step.recursive || step.wildcard || step.slice {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Select returns the values the query selects from value, which must be in
+// the form encoding/json decodes into: maps, slices and scalars. Members are
+// visited in key order so results are stable.
+func (t *Query) Select(value interface{}) []interface{} {
+	values := []interface{}{value}
+
+	for _, step := range t.steps {
+		next := []interface{}{}
+
+		for _, v := range values {
+			if step.recursive {
+				for _, d := range descendants(v) {
+					next = append(next, step.apply(d)...)
+				}
+			} else {
+				next = append(next, step.apply(v)...)
+			}
+		}
+
+		values = next
+	}
+
+	return values
+}
+
+func (t *queryStep) apply(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if t.wildcard {
+			selected := []interface{}{}
+
+			for _, key := range sortedKeys(v) {
+				selected = append(selected, v[key])
+			}
+
+			return selected
+		}
+
+		if member, ok := v[t.name]; ok && t.index == nil && !t.slice {
+			return []interface{}{member}
+		}
+
+	case []interface{}:
+		switch {
+		case t.wildcard:
+			return v
+		case t.index != nil:
+			i := *t.index
+
+			if i < 0 {
+				i += len(v)
+			}
+
+			if i >= 0 && i < len(v) {
+				return []interface{}{v[i]}
+			}
+		case t.slice:
+			start, end := clamp(t.start, 0, len(v)), clamp(t.end, len(v), len(v))
+
+			if start < end {
+				return v[start:end]
+			}
+		}
+	}
+
+	return nil
+}
+
+func clamp(position *int, missing, length int) int {
+	if position == nil {
+		return missing
+	}
+
+	i := *position
+
+	if i < 0 {
+		i += length
+	}
+
+	if i < 0 {
+		return 0
+	}
+
+	if i > length {
+		return length
+	}
+
+	return i
+}
+
+// descendants returns value and everything nested in it, parents first.
+func descendants(value interface{}) []interface{} {
+	all := []interface{}{value}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			all = append(all, descendants(v[key])...)
+		}
+	case []interface{}:
+		for _, e := range v {
+			all = append(all, descendants(e)...)
+		}
+	}
+
+	return all
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (t *Query) String() string {
+	return t.text
+}
@@ -0,0 +1,35 @@
+package secret
+
+import "os"
+
+// envBackend reads secrets from environment variables, e.g. "env:DEVICEIO_KEY".
+type envBackend struct{}
+
+func init() {
+	Register("env", &envBackend{})
+}
+
+func (t *envBackend) Get(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+
+	if !ok {
+		return "", &ErrNoSuchSecret{
+			Scheme: "env",
+			Name:   name,
+		}
+	}
+
+	return value, nil
+}
+
+func (t *envBackend) Set(name, value string) error {
+	return &ErrReadOnlyBackend{
+		Scheme: "env",
+	}
+}
+
+func (t *envBackend) Delete(name string) error {
+	return &ErrReadOnlyBackend{
+		Scheme: "env",
+	}
+}
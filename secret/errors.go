@@ -0,0 +1,36 @@
+package secret
+
+import "fmt"
+
+type ErrUnknownBackend struct {
+	Scheme string
+}
+
+func (t *ErrUnknownBackend) Error() string {
+	return fmt.Sprintf("no secret backend registered for '%v'", t.Scheme)
+}
+
+type ErrNoSuchSecret struct {
+	Scheme string
+	Name   string
+}
+
+func (t *ErrNoSuchSecret) Error() string {
+	return fmt.Sprintf("no secret named '%v' in the %v backend", t.Name, t.Scheme)
+}
+
+type ErrReadOnlyBackend struct {
+	Scheme string
+}
+
+func (t *ErrReadOnlyBackend) Error() string {
+	return fmt.Sprintf("secrets cannot be stored in the %v backend", t.Scheme)
+}
+
+type ErrIncorrectPassphrase struct {
+	Path string
+}
+
+func (t *ErrIncorrectPassphrase) Error() string {
+	return fmt.Sprintf("incorrect passphrase for keystore '%v'", t.Path)
+}
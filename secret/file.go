@@ -0,0 +1,53 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/palantir/stacktrace"
+)
+
+// fileBackend reads secrets from the contents of a file, e.g.
+// "file:~/.secrets/deviceio.key". Surrounding whitespace is trimmed.
+type fileBackend struct{}
+
+func init() {
+	Register("file", &fileBackend{})
+}
+
+func (t *fileBackend) Get(name string) (string, error) {
+	path, err := homedir.Expand(name)
+
+	if err != nil {
+		return "", stacktrace.Propagate(err, "failed to expand secret file path %v", name)
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return "", &ErrNoSuchSecret{
+			Scheme: "file",
+			Name:   name,
+		}
+	}
+
+	if err != nil {
+		return "", stacktrace.Propagate(err, "failed to read secret file %v", path)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (t *fileBackend) Set(name, value string) error {
+	return &ErrReadOnlyBackend{
+		Scheme: "file",
+	}
+}
+
+func (t *fileBackend) Delete(name string) error {
+	return &ErrReadOnlyBackend{
+		Scheme: "file",
+	}
+}
@@ -0,0 +1,261 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/palantir/stacktrace"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	keystoreScryptN = 32768
+	keystoreScryptR = 8
+	keystoreScryptP = 1
+	keystoreKeyLen  = 32
+	keystoreSaltLen = 32
+)
+
+// Keystore is a local file of secrets encrypted with AES-256-GCM under a key
+// derived from a passphrase with scrypt.
+type Keystore struct {
+	path       string
+	passphrase func() (string, error)
+	key        []byte
+	mu         sync.Mutex
+}
+
+type keystoreFile struct {
+	Version int                       `json:"version"`
+	Salt    []byte                    `json:"salt"`
+	N       int                       `json:"n"`
+	R       int                       `json:"r"`
+	P       int                       `json:"p"`
+	Entries map[string]*keystoreEntry `json:"entries"`
+}
+
+type keystoreEntry struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewKeystore returns a keystore backed by the file at path. passphrase is
+// only invoked the first time a secret is read or written.
+func NewKeystore(path string, passphrase func() (string, error)) *Keystore {
+	return &Keystore{
+		path:       path,
+		passphrase: passphrase,
+	}
+}
+
+func (t *Keystore) Get(name string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ks, err := t.load()
+
+	if err != nil {
+		return "", err
+	}
+
+	entry, ok := ks.Entries[name]
+
+	if !ok {
+		return "", &ErrNoSuchSecret{
+			Scheme: "keystore",
+			Name:   name,
+		}
+	}
+
+	aead, err := t.aead(ks)
+
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := aead.Open(nil, entry.Nonce, entry.Ciphertext, []byte(name))
+
+	if err != nil {
+		t.key = nil
+		return "", &ErrIncorrectPassphrase{
+			Path: t.path,
+		}
+	}
+
+	return string(plaintext), nil
+}
+
+func (t *Keystore) Set(name, value string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ks, err := t.load()
+
+	if err != nil {
+		return err
+	}
+
+	aead, err := t.aead(ks)
+
+	if err != nil {
+		return err
+	}
+
+	if err := t.verify(ks, aead); err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return stacktrace.Propagate(err, "failed to generate keystore nonce")
+	}
+
+	ks.Entries[name] = &keystoreEntry{
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, []byte(value), []byte(name)),
+	}
+
+	return t.save(ks)
+}
+
+// Delete removes an entry. Entry names are not encrypted, so no passphrase
+// is needed.
+func (t *Keystore) Delete(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := os.Stat(t.path); os.IsNotExist(err) {
+		return nil
+	}
+
+	ks, err := t.load()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ks.Entries[name]; !ok {
+		return nil
+	}
+
+	delete(ks.Entries, name)
+
+	return t.save(ks)
+}
+
+// verify ensures the passphrase opens an existing entry before a new entry is
+// sealed, so a mistyped passphrase cannot leave the keystore with entries
+// under two different keys.
+func (t *Keystore) verify(ks *keystoreFile, aead cipher.AEAD) error {
+	for name, entry := range ks.Entries {
+		if _, err := aead.Open(nil, entry.Nonce, entry.Ciphertext, []byte(name)); err != nil {
+			t.key = nil
+			return &ErrIncorrectPassphrase{
+				Path: t.path,
+			}
+		}
+
+		break
+	}
+
+	return nil
+}
+
+func (t *Keystore) aead(ks *keystoreFile) (cipher.AEAD, error) {
+	if t.key == nil {
+		passphrase, err := t.passphrase()
+
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "failed to obtain keystore passphrase")
+		}
+
+		key, err := scrypt.Key([]byte(passphrase), ks.Salt, ks.N, ks.R, ks.P, keystoreKeyLen)
+
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "failed to derive keystore key")
+		}
+
+		t.key = key
+	}
+
+	block, err := aes.NewCipher(t.key)
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to create keystore cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (t *Keystore) load() (*keystoreFile, error) {
+	content, err := ioutil.ReadFile(t.path)
+
+	if os.IsNotExist(err) {
+		salt := make([]byte, keystoreSaltLen)
+
+		if _, err := rand.Read(salt); err != nil {
+			return nil, stacktrace.Propagate(err, "failed to generate keystore salt")
+		}
+
+		return &keystoreFile{
+			Version: keystoreVersion,
+			Salt:    salt,
+			N:       keystoreScryptN,
+			R:       keystoreScryptR,
+			P:       keystoreScryptP,
+			Entries: map[string]*keystoreEntry{},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to read keystore %v", t.path)
+	}
+
+	ks := &keystoreFile{}
+
+	if err := json.Unmarshal(content, ks); err != nil {
+		return nil, stacktrace.Propagate(err, "failed to parse keystore %v", t.path)
+	}
+
+	if ks.Version != keystoreVersion {
+		return nil, stacktrace.NewError("unsupported keystore version %v in %v", ks.Version, t.path)
+	}
+
+	if ks.Entries == nil {
+		ks.Entries = map[string]*keystoreEntry{}
+	}
+
+	return ks, nil
+}
+
+func (t *Keystore) save(ks *keystoreFile) error {
+	content, err := json.MarshalIndent(ks, "", "    ")
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to encode keystore")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		return stacktrace.Propagate(err, "failed to create keystore directory")
+	}
+
+	tmp := t.path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return stacktrace.Propagate(err, "failed to write keystore %v", tmp)
+	}
+
+	if err := os.Rename(tmp, t.path); err != nil {
+		return stacktrace.Propagate(err, "failed to replace keystore %v", t.path)
+	}
+
+	return nil
+}
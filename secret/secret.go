@@ -0,0 +1,94 @@
+package secret
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backend stores and retrieves named secrets. Profiles refer to a secret held
+// by a backend with a "<scheme>:<name>" reference in place of the plaintext
+// value.
+type Backend interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+var backends = map[string]Backend{}
+
+func Register(scheme string, backend Backend) {
+	backends[scheme] = backend
+}
+
+func IsReference(value string) bool {
+	_, _, ok := ParseReference(value)
+	return ok
+}
+
+// Resolve returns the secret a profile value refers to. Values that are not a
+// reference to a registered backend are returned unchanged so existing
+// plaintext profiles keep working.
+func Resolve(value string) (string, error) {
+	scheme, name, ok := ParseReference(value)
+
+	if !ok {
+		return value, nil
+	}
+
+	return backends[scheme].Get(name)
+}
+
+// Store saves value in the backend registered for scheme and returns the
+// reference to write into the profile.
+func Store(scheme, name, value string) (string, error) {
+	backend, ok := backends[scheme]
+
+	if !ok {
+		return "", &ErrUnknownBackend{
+			Scheme: scheme,
+		}
+	}
+
+	if err := backend.Set(name, value); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v:%v", scheme, name), nil
+}
+
+// Delete removes the secret name from the backend registered for scheme. A
+// secret that does not exist is not an error.
+func Delete(scheme, name string) error {
+	backend, ok := backends[scheme]
+
+	if !ok {
+		return &ErrUnknownBackend{
+			Scheme: scheme,
+		}
+	}
+
+	err := backend.Delete(name)
+
+	if _, ok := err.(*ErrNoSuchSecret); ok {
+		return nil
+	}
+
+	return err
+}
+
+// ParseReference splits a reference into the scheme of its backend and the
+// name of the secret. ok is false for values that are not a reference to a
+// registered backend.
+func ParseReference(value string) (scheme, name string, ok bool) {
+	parts := strings.SplitN(value, ":", 2)
+
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	if _, ok := backends[parts[0]]; !ok {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+)
+
+const secretServiceAttribute = "deviceio-cli"
+
+// secretServiceBackend stores secrets in the freedesktop Secret Service
+// (gnome-keyring, KWallet) through the libsecret secret-tool utility.
+type secretServiceBackend struct{}
+
+func init() {
+	Register("secretservice", &secretServiceBackend{})
+}
+
+// SecretServiceAvailable reports whether a Secret Service can be reached from
+// this session.
+func SecretServiceAvailable() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+
+	_, err := exec.LookPath("secret-tool")
+
+	return err == nil
+}
+
+func (t *secretServiceBackend) Get(name string) (string, error) {
+	stdout := &bytes.Buffer{}
+
+	cmd := exec.Command("secret-tool", "lookup", "service", secretServiceAttribute, "account", name)
+	cmd.Stdout = stdout
+
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", &ErrNoSuchSecret{
+				Scheme: "secretservice",
+				Name:   name,
+			}
+		}
+
+		return "", stacktrace.Propagate(err, "failed to run secret-tool")
+	}
+
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+func (t *secretServiceBackend) Set(name, value string) error {
+	cmd := exec.Command(
+		"secret-tool", "store",
+		"--label", "deviceio-cli "+name,
+		"service", secretServiceAttribute,
+		"account", name,
+	)
+	cmd.Stdin = strings.NewReader(value)
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return stacktrace.Propagate(err, "failed to store secret %v in the secret service", name)
+	}
+
+	return nil
+}
+
+func (t *secretServiceBackend) Delete(name string) error {
+	cmd := exec.Command("secret-tool", "clear", "service", secretServiceAttribute, "account", name)
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return stacktrace.Propagate(err, "failed to delete secret %v from the secret service", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package tlsconfig
+
+import "fmt"
+
+type ErrPinMismatch struct {
+	Expected string
+	Actual   string
+}
+
+func (t *ErrPinMismatch) Error() string {
+	return fmt.Sprintf(
+		"hub certificate fingerprint %v does not match pinned fingerprint %v",
+		FormatFingerprint(t.Actual),
+		FormatFingerprint(t.Expected),
+	)
+}
@@ -0,0 +1,229 @@
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+)
+
+// Config describes how connections to the hub are verified and, optionally,
+// which client certificate is presented for mutual TLS.
+type Config struct {
+	// SkipVerify disables all server certificate verification.
+	SkipVerify bool
+
+	// CAFile is a PEM bundle of certificate authorities trusted in place of
+	// the system roots.
+	CAFile string
+
+	// PinSHA256 is the hex SHA-256 digest of the hub certificate's
+	// SubjectPublicKeyInfo. When set, a certificate matching the pin is
+	// trusted even if it is self-signed, unless CAFile is also set in which
+	// case both the chain and the pin must verify.
+	PinSHA256 string
+
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+func (t *Config) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if t.ClientCertFile != "" || t.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCertFile, t.ClientKeyFile)
+
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "failed to load client certificate")
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.SkipVerify {
+		config.InsecureSkipVerify = true
+		return config, nil
+	}
+
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "failed to read hub ca file %v", t.CAFile)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, stacktrace.NewError("no certificates found in hub ca file %v", t.CAFile)
+		}
+	}
+
+	if t.PinSHA256 == "" {
+		return config, nil
+	}
+
+	pin := NormalizeFingerprint(t.PinSHA256)
+	roots := config.RootCAs
+	verifyChain := t.CAFile != ""
+
+	// Chain verification is done by hand below so that a pinned self-signed
+	// certificate can be accepted.
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return stacktrace.NewError("hub presented no certificate")
+		}
+
+		leaf := state.PeerCertificates[0]
+
+		if verifyChain {
+			intermediates := x509.NewCertPool()
+
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+
+			if _, err := leaf.Verify(x509.VerifyOptions{
+				DNSName:       state.ServerName,
+				Roots:         roots,
+				Intermediates: intermediates,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if actual := Fingerprint(leaf); actual != pin {
+			return &ErrPinMismatch{
+				Expected: pin,
+				Actual:   actual,
+			}
+		}
+
+		return nil
+	}
+
+	return config, nil
+}
+
+// Fingerprint returns the hex SHA-256 digest of the certificate's
+// SubjectPublicKeyInfo, the value used for hub_cert_sha256 pins.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint accepts fingerprints in upper or lower case and with
+// or without colon separators.
+func NormalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(fingerprint), ":", "", -1))
+}
+
+// FormatFingerprint renders a fingerprint as colon separated upper case pairs.
+func FormatFingerprint(fingerprint string) string {
+	fingerprint = strings.ToUpper(NormalizeFingerprint(fingerprint))
+	pairs := []string{}
+
+	for i := 0; i+2 <= len(fingerprint); i += 2 {
+		pairs = append(pairs, fingerprint[i:i+2])
+	}
+
+	return strings.Join(pairs, ":")
+}
+
+// FetchCertificate connects to addr without verification and returns the
+// certificate chain it presents, together with whether that chain verifies
+// against config's trust roots.
+func FetchCertificate(addr string, config *Config) ([]*x509.Certificate, bool, error) {
+	tlsconfig, err := (&Config{
+		SkipVerify:     true,
+		ClientCertFile: config.ClientCertFile,
+		ClientKeyFile:  config.ClientKeyFile,
+	}).TLSConfig()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	conn, err := tls.Dial("tcp", addr, tlsconfig)
+
+	if err != nil {
+		return nil, false, stacktrace.Propagate(err, "failed to connect to %v", addr)
+	}
+	defer conn.Close()
+
+	chain := conn.ConnectionState().PeerCertificates
+
+	if len(chain) == 0 {
+		return nil, false, stacktrace.NewError("%v presented no certificate", addr)
+	}
+
+	verifyconfig, err := (&Config{CAFile: config.CAFile}).TLSConfig()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return nil, false, stacktrace.Propagate(err, "invalid hub address %v", addr)
+	}
+
+	_, verr := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         verifyconfig.RootCAs,
+		Intermediates: intermediates,
+	})
+
+	return chain, verr == nil, nil
+}
+
+// CurlArgs returns curl options verifying the hub the same way as TLSConfig.
+// A pin without a CA file is passed with -k since curl would otherwise
+// reject a self-signed certificate before checking the pin.
+func (t *Config) CurlArgs() []string {
+	args := []string{}
+
+	if t.ClientCertFile != "" {
+		args = append(args, "--cert", t.ClientCertFile, "--key", t.ClientKeyFile)
+	}
+
+	if t.SkipVerify {
+		return append(args, "-k")
+	}
+
+	if t.CAFile != "" {
+		args = append(args, "--cacert", t.CAFile)
+	}
+
+	if t.PinSHA256 == "" {
+		return args
+	}
+
+	if t.CAFile == "" {
+		args = append(args, "-k")
+	}
+
+	pin, err := hex.DecodeString(NormalizeFingerprint(t.PinSHA256))
+
+	if err != nil {
+		return args
+	}
+
+	return append(args, "--pinnedpubkey", "sha256//"+base64.StdEncoding.EncodeToString(pin))
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Config tunes the connections made to a hub. Zero values take the default
+// documented on each field.
+type Config struct {
+	TLS *tls.Config
+
+	// DialTimeout limits establishing a tcp connection. Defaults to 10
+	// seconds.
+	DialTimeout time.Duration
+
+	// KeepAlive is the tcp keep-alive period. Defaults to 30 seconds.
+	KeepAlive time.Duration
+
+	// IdleTimeout closes pooled connections left idle for this long.
+	// Defaults to 90 seconds.
+	IdleTimeout time.Duration
+
+	// MaxIdlePerHost is the number of idle connections kept for reuse per
+	// hub. Defaults to 16.
+	MaxIdlePerHost int
+
+	// ResponseTimeout limits how long each request waits for the hub to
+	// send response headers. Streamed response bodies are not limited. Zero
+	// waits indefinitely.
+	ResponseTimeout time.Duration
+
+	// DisableHTTP2 keeps connections on HTTP/1.1 even when the hub offers
+	// HTTP/2.
+	DisableHTTP2 bool
+}
+
+// New returns a transport for the config. Requests go through the proxy
+// named by HTTPS_PROXY unless the hub is listed in NO_PROXY, and HTTP/2 is
+// negotiated with hubs supporting it so concurrent requests share one
+// connection.
+func New(config *Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   durationOr(config.DialTimeout, 10*time.Second),
+		KeepAlive: durationOr(config.KeepAlive, 30*time.Second),
+	}
+
+	maxIdle := config.MaxIdlePerHost
+
+	if maxIdle <= 0 {
+		maxIdle = 16
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       config.TLS,
+		TLSHandshakeTimeout:   10 * time.Second,
+		IdleConnTimeout:       durationOr(config.IdleTimeout, 90*time.Second),
+		MaxIdleConns:          maxIdle * 4,
+		MaxIdleConnsPerHost:   maxIdle,
+		ResponseHeaderTimeout: config.ResponseTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+	}
+
+	if config.DisableHTTP2 {
+		// A non-nil empty map stops the transport from offering h2.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return transport
+}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+
+	return d
+}
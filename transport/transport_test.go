@@ -0,0 +1,36 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewNegotiatesHTTP2(t *testing.T) {
+	hub := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	hub.EnableHTTP2 = true
+	hub.StartTLS()
+	defer hub.Close()
+
+	for _, disable := range []bool{false, true} {
+		client := &http.Client{
+			Transport: New(&Config{
+				TLS:          &tls.Config{InsecureSkipVerify: true},
+				DisableHTTP2: disable,
+			}),
+		}
+
+		resp, err := client.Get(hub.URL)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if expected := map[bool]int{false: 2, true: 1}[disable]; resp.ProtoMajor != expected {
+			t.Fatalf("DisableHTTP2 %v: expected HTTP/%v, got %v", disable, expected, resp.Proto)
+		}
+	}
+}
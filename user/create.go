@@ -0,0 +1,41 @@
+package user
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/deviceio/cli/auth"
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+// Create registers a new hub user. The key pair and totp secret are generated
+// locally and the private key never leaves this machine; only the public key
+// and the totp secret the hub needs to verify passcodes are uploaded.
+func Create(userid string, c hmapi.Client) (*auth.Credentials, error) {
+	creds, err := auth.GenerateCredentials(userid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.
+		Resource("/user").
+		Form("create").
+		AddFieldAsString("id", creds.UserID).
+		AddFieldAsString("public_key", creds.PublicKey).
+		AddFieldAsString("totp_secret", creds.TOTPSecret).
+		Submit(context.Background())
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to create user %v", userid)
+	}
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, stacktrace.NewErrorWithCode(exitcode.FromStatus(resp.StatusCode), "failed to create user %v: %v", userid, exitcode.Response(resp.StatusCode, body))
+	}
+
+	return creds, nil
+}
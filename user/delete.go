@@ -0,0 +1,29 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+func Delete(userid string, c hmapi.Client) error {
+	resp, err := c.
+		Resource(fmt.Sprintf("/user/%v", userid)).
+		Form("delete").
+		Submit(context.Background())
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to delete user %v", userid)
+	}
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return stacktrace.NewErrorWithCode(exitcode.FromStatus(resp.StatusCode), "failed to delete user %v: %v", userid, exitcode.Response(resp.StatusCode, body))
+	}
+
+	return nil
+}
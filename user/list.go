@@ -0,0 +1,45 @@
+package user
+
+import (
+	"context"
+	"sort"
+
+	"github.com/deviceio/cli/output"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+type listedUser struct {
+	ID   string `json:"id"`
+	Href string `json:"href"`
+}
+
+// List renders the users registered with the hub.
+func List(c hmapi.Client, out *output.Renderer) error {
+	res, err := c.Resource("/user").Get(context.Background())
+
+	if err != nil {
+		return stacktrace.Propagate(err, "failed to list users")
+	}
+
+	ids := []string{}
+
+	for id := range res.Links {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	out.Columns(
+		output.Column{Header: "USER ID", Path: "id"},
+		output.Column{Header: "RESOURCE", Path: "href"},
+	)
+
+	for _, id := range ids {
+		if err := out.Add(&listedUser{ID: id, Href: res.Links[id].Href}); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
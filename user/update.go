@@ -0,0 +1,39 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/deviceio/cli/auth"
+	"github.com/deviceio/cli/exitcode"
+	"github.com/deviceio/hmapi"
+	"github.com/palantir/stacktrace"
+)
+
+// Update rotates the key pair and totp secret of an existing hub user.
+func Update(userid string, c hmapi.Client) (*auth.Credentials, error) {
+	creds, err := auth.GenerateCredentials(userid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.
+		Resource(fmt.Sprintf("/user/%v", userid)).
+		Form("update").
+		AddFieldAsString("public_key", creds.PublicKey).
+		AddFieldAsString("totp_secret", creds.TOTPSecret).
+		Submit(context.Background())
+
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "failed to update user %v", userid)
+	}
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, stacktrace.NewErrorWithCode(exitcode.FromStatus(resp.StatusCode), "failed to update user %v: %v", userid, exitcode.Response(resp.StatusCode, body))
+	}
+
+	return creds, nil
+}